@@ -0,0 +1,156 @@
+package ch03
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock은 현재 시각과 타이머를 제공하는 시계입니다.
+// 실제 시간을 쓰는 RealClock 대신 FakeClock을 주입하면 시간에 의존하는 코드를 기다림 없이 테스트할 수 있습니다.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer는 Clock이 만든 타이머입니다. time.Timer와 같은 의미로 동작합니다.
+type Timer interface {
+	C() <-chan time.Time // AfterFunc로 만든 타이머는 nil을 반환
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// RealClock은 time 패키지를 그대로 사용하는 시계입니다.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer { return realTimer{time.AfterFunc(d, f)} }
+
+// realTimer는 time.Timer를 Timer 인터페이스로 감쌉니다.
+type realTimer struct{ *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
+
+// FakeClock은 Advance를 호출할 때만 시간이 흐르는 시계입니다.
+// 시간이 흐르면 만료 시각이 지난 타이머를 만료 순서대로 실행하며, AfterFunc의 함수는 Advance를 호출한 고루틴에서 실행합니다.
+type FakeClock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond // 타이머가 예약될 때마다 WaitForTimer를 깨움
+	now    time.Time
+	timers map[*fakeTimer]struct{} // 예약된(아직 만료되지 않은) 타이머
+}
+
+// NewFakeClock은 start 시각에 멈춰 있는 FakeClock을 생성합니다.
+func NewFakeClock(start time.Time) *FakeClock {
+	c := &FakeClock{now: start, timers: make(map[*fakeTimer]struct{})}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now는 시계의 현재 시각을 반환합니다.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer는 d 뒤에 채널로 시각을 보내는 타이머를 생성합니다.
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// AfterFunc는 d 뒤에 f를 실행하는 타이머를 생성합니다.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	t := &fakeTimer{clock: c, f: f}
+	t.Reset(d)
+	return t
+}
+
+// Advance는 시간을 d만큼 흐르게 하고, 그 사이에 만료되는 타이머를 만료 시각 순서대로 실행합니다.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	for {
+		// 만료 시각이 가장 이른 타이머를 찾음
+		var next *fakeTimer
+		for t := range c.timers {
+			if !t.when.After(target) && (next == nil || t.when.Before(next.when)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+
+		delete(c.timers, next)
+		c.now = next.when
+		if next.f != nil {
+			c.mu.Unlock()
+			next.f() // 함수 안에서 시계를 사용할 수 있도록 잠금을 푼 상태로 실행
+			c.mu.Lock()
+			continue
+		}
+		select {
+		case next.c <- c.now:
+		default: // time.Timer와 같이 이전 값을 읽지 않았으면 버림
+		}
+	}
+	c.now = target
+	c.mu.Unlock()
+}
+
+// WaitForTimer는 지금부터 d 뒤에 만료되는 타이머가 예약될 때까지 기다립니다.
+// 테스트 대상 고루틴이 타이머를 예약하거나 Reset한 뒤에 Advance를 호출하도록 동기화할 때 사용합니다.
+func (c *FakeClock) WaitForTimer(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for {
+		when := c.now.Add(d)
+		for t := range c.timers {
+			if t.when.Equal(when) {
+				return
+			}
+		}
+		c.cond.Wait()
+	}
+}
+
+// fakeTimer는 FakeClock의 타이머입니다.
+type fakeTimer struct {
+	clock *FakeClock
+	c     chan time.Time
+	f     func()
+	when  time.Time // clock.mu로 보호
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+// Stop은 타이머를 취소하고, 만료되기 전에 취소했으면 true를 반환합니다.
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	_, active := t.clock.timers[t]
+	delete(t.clock.timers, t)
+	return active
+}
+
+// Reset은 타이머를 지금부터 d 뒤에 만료되도록 다시 예약하고, 만료되기 전에 다시 예약했으면 true를 반환합니다.
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	_, active := t.clock.timers[t]
+	t.when = t.clock.now.Add(d)
+	t.clock.timers[t] = struct{}{}
+	t.clock.cond.Broadcast()
+	return active
+}
@@ -0,0 +1,54 @@
+package ch03
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFakeClock은 FakeClock이 Advance할 때만 시간이 흐르고, 만료된 타이머를 순서대로 실행하는지 테스트합니다.
+func TestFakeClock(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := NewFakeClock(start)
+
+	var fired []time.Duration // AfterFunc가 실행된 시점 (시작 이후 경과 시간)
+	record := func() { fired = append(fired, clock.Now().Sub(start)) }
+
+	clock.AfterFunc(3*time.Second, record)
+	clock.AfterFunc(time.Second, record)
+	stopped := clock.AfterFunc(2*time.Second, record)
+	if !stopped.Stop() {
+		t.Error("expected Stop to cancel a pending timer")
+	}
+
+	timer := clock.NewTimer(2 * time.Second)
+	clock.Advance(1500 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+
+	clock.Advance(2 * time.Second)
+	if now := clock.Now().Sub(start); now != 3500*time.Millisecond {
+		t.Errorf("expected 3.5s elapsed; actual %s", now)
+	}
+	if len(fired) != 2 || fired[0] != time.Second || fired[1] != 3*time.Second {
+		t.Errorf("expected timers at 1s and 3s; actual %v", fired)
+	}
+
+	// 만료된 타이머의 채널에는 만료 시각이 들어 있음
+	select {
+	case at := <-timer.C():
+		if at.Sub(start) != 2*time.Second {
+			t.Errorf("expected timer to fire at 2s; actual %s", at.Sub(start))
+		}
+	default:
+		t.Fatal("timer did not fire")
+	}
+	if timer.Stop() {
+		t.Error("expected Stop to report an expired timer")
+	}
+	if timer.Reset(time.Second) {
+		t.Error("expected Reset to report an expired timer")
+	}
+}
@@ -0,0 +1,36 @@
+package ch03
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// timeoutError는 DialTimeoutClock의 시간이 초과되었을 때 반환되는 net.Error입니다.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// DialTimeoutClock은 clock으로 잰 timeout 안에 연결되지 않으면 타임아웃 에러를 반환하는 Dial입니다.
+// net.Dialer의 Timeout은 항상 실제 시간을 사용하므로, 대신 clock의 타이머로 컨텍스트를 취소합니다.
+// d가 nil이면 기본 Dialer를 사용합니다.
+func DialTimeoutClock(clock Clock, d *net.Dialer, network, address string, timeout time.Duration) (net.Conn, error) {
+	if d == nil {
+		d = new(net.Dialer)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	timer := clock.AfterFunc(timeout, cancel) // 시간이 지나면 연결 시도를 취소
+	defer timer.Stop()
+
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil && ctx.Err() != nil {
+		// 취소 에러 대신 타임아웃 에러를 반환
+		return nil, &net.OpError{Op: "dial", Net: network, Err: timeoutError{}}
+	}
+	return conn, err
+}
@@ -1,7 +1,10 @@
 package ch03
 
 import (
+	"context"
+	"io"
 	"net"
+	"path/filepath"
 	"syscall"
 	"testing"
 	"time"
@@ -47,3 +50,91 @@ func TestDialTimeout(t *testing.T) {
 		t.Fatal("error is not a timeout") // 타임아웃 에러가 아니면 실패
 	}
 }
+
+// TestDialTimeoutUnix는 DialTimeoutClock이 실제 Unix 도메인 소켓에 연결하고,
+// 존재하지 않는 소켓에는 타임아웃이 아닌 에러를 바로 반환하는지 테스트합니다.
+func TestDialTimeoutUnix(t *testing.T) {
+	clock := NewFakeClock(time.Now()) // 시간을 진행하지 않으므로 타임아웃은 발생하지 않음
+	socket := filepath.Join(t.TempDir(), "dial.sock")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("hello"))
+	}()
+
+	conn, err := DialTimeoutClock(clock, nil, "unix", socket, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 5)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("expected %q; actual %q %v", "hello", buf, err)
+	}
+
+	// 듣고 있지 않은 경로는 타임아웃을 기다리지 않고 실패해야 함
+	_, err = DialTimeoutClock(clock, nil, "unix", filepath.Join(t.TempDir(), "missing.sock"), 5*time.Second)
+	if err == nil {
+		t.Fatal("expected dial error")
+	}
+	if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
+		t.Errorf("expected non-timeout error; actual %v", err)
+	}
+}
+
+// TestDialTimeoutClock은 DialTimeoutClock이 주입된 시계의 시간이 지나면 타임아웃 에러를 반환하는지 테스트합니다.
+func TestDialTimeoutClock(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+
+	// 연결 시도가 취소될 때까지 블로킹하는 Dialer를 생성합니다.
+	d := &net.Dialer{
+		ControlContext: func(ctx context.Context, _, _ string, _ syscall.RawConn) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		conn, err := DialTimeoutClock(clock, d, "tcp", "10.0.0.1:http", 5*time.Second)
+		if conn != nil {
+			conn.Close()
+		}
+		errs <- err
+	}()
+
+	// 실제로 5초를 기다리지 않고 시계만 5초 진행합니다.
+	clock.WaitForTimer(5 * time.Second)
+	clock.Advance(5 * time.Second)
+
+	err := <-errs
+	nErr, ok := err.(net.Error)
+	if !ok || !nErr.Timeout() {
+		t.Fatalf("expected timeout error; actual %v", err) // 타임아웃 에러가 아니면 실패
+	}
+
+	// 시간 안에 연결되면 정상적으로 연결을 반환합니다.
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	conn, err := DialTimeoutClock(clock, nil, "tcp", listener.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
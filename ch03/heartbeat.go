@@ -0,0 +1,365 @@
+package ch03
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultMaxMissed = 3 // 상대가 죽었다고 판단하기까지 기본으로 허용하는 연속 무응답 횟수
+
+// 하트비트 에러 정의
+var (
+	ErrPeerDead        = errors.New("peer is not responding to pings")          // 상대가 정해진 횟수 이상 ping에 응답하지 않음
+	ErrInvalidEncoding = errors.New("heartbeat encoding needs Ping and IsPong") // Encoding에 필요한 함수가 없음
+)
+
+// Heartbeat는 Pinger로 주기적으로 "ping"을 보내고 상대의 "pong" 응답을 확인합니다.
+// 상대가 보낸 "ping"에는 "pong"으로 응답하므로 양쪽에서 함께 사용할 수 있습니다.
+//
+// 각 ping은 "ping <순번> <타임스탬프>" 형식으로 보내고 상대는 같은 값을 pong에 담아 돌려주므로,
+// 응답이 늦게 도착하거나 순서가 바뀌어도 각 ping의 왕복 시간을 잴 수 있습니다.
+// 왕복 시간 통계를 따로 보관하므로 Heartbeat 하나는 연결 하나에만 사용해야 합니다.
+type Heartbeat struct {
+	Interval  time.Duration // ping 간격 (0이면 defaultPingInterval)
+	MaxMissed int           // 상대가 죽었다고 판단할 연속 무응답 횟수 (0이면 defaultMaxMissed)
+	RTTWindow int           // 왕복 시간 통계에 사용할 최근 표본 수 (0이면 defaultRTTWindow)
+
+	// Clock이 설정되면 ping 간격과 왕복 시간을 이 시계로 잼 (nil이면 RealClock)
+	// 연결의 읽기 데드라인은 운영체제가 처리하므로 항상 실제 시간을 사용함
+	Clock Clock
+
+	// Encoding이 설정되면 텍스트 ping/pong 대신 이 형식의 메시지를 주고받음 (예: ch04 프레임)
+	// 메시지 단위로 나누어 읽으므로 애플리케이션 프레임과 섞여 있어도 스트림을 망가뜨리지 않음
+	Encoding *HeartbeatEncoding
+
+	// OnMessage가 설정되면 하트비트가 아닌 메시지(Encoding이 없으면 줄)를 받을 때마다 호출되고,
+	// 설정되지 않으면 그런 메시지는 버림. msg는 다음 메시지를 읽으면 덮어써지므로 보관하려면 복사해야 하며,
+	// Run의 읽기 루프에서 호출되므로 오래 걸리면 pong 처리도 늦어짐
+	OnMessage func(msg []byte)
+
+	// OnDead가 설정되면 상대가 죽었다고 판단할 때 호출되고, 설정되지 않으면 연결을 닫음
+	OnDead func(conn net.Conn)
+
+	rttOnce sync.Once
+	rtt     *rttWindow
+}
+
+// RTT는 최근 RTTWindow개의 ping 왕복 시간 통계를 반환합니다. pong을 받기 전이면 Count가 0입니다.
+func (h *Heartbeat) RTT() RTTStats {
+	return h.window().stats()
+}
+
+// window는 왕복 시간 표본을 보관하는 창을 반환합니다.
+func (h *Heartbeat) window() *rttWindow {
+	h.rttOnce.Do(func() { h.rtt = newRTTWindow(h.RTTWindow) })
+	return h.rtt
+}
+
+// interval은 실제로 적용할 ping 간격을 반환합니다.
+func (h *Heartbeat) interval() time.Duration {
+	if h.Interval > 0 {
+		return h.Interval
+	}
+	return defaultPingInterval
+}
+
+// clock은 실제로 사용할 시계를 반환합니다.
+func (h *Heartbeat) clock() Clock {
+	if h.Clock != nil {
+		return h.Clock
+	}
+	return RealClock
+}
+
+// maxMissed는 실제로 적용할 연속 무응답 허용 횟수를 반환합니다.
+func (h *Heartbeat) maxMissed() int {
+	if h.MaxMissed > 0 {
+		return h.MaxMissed
+	}
+	return defaultMaxMissed
+}
+
+// Run은 ctx가 취소되거나 연결이 끝나거나 상대가 죽었다고 판단할 때까지 conn에서 하트비트를 주고받습니다.
+// pong을 받을 때마다 conn의 읽기 데드라인을 (MaxMissed + 1) * Interval 뒤로 연장하므로,
+// 상대가 아무것도 보내지 않아도 결국 읽기 타임아웃으로 감지합니다.
+// 상대가 죽었으면 ErrPeerDead를, ctx가 취소되면 ctx.Err()를, 상대가 연결을 닫으면 io.EOF를 반환합니다.
+// ping 하나는 Interval 안에 써야 하며, 그동안 conn의 쓰기 데드라인을 덮어쓰므로 Run을 사용하는 동안
+// 애플리케이션은 conn에 자신의 쓰기 데드라인을 두지 않아야 합니다.
+// ping을 쓰지 못하면(쓰기 데드라인 초과 포함) 상대가 죽은 것으로 보고, ErrPeerDead와 Pinger가 종료된 원인을
+// 함께 담은 에러를 반환하므로 errors.As로 *PingError를 꺼낼 수 있습니다.
+// Encoding의 ping 메시지를 만들지 못하면 PingMessageFailed 원인의 *PingError를 반환합니다.
+// Encoding에 Ping이나 IsPong이 없으면 아무것도 보내지 않고 ErrInvalidEncoding을 반환합니다.
+func (h *Heartbeat) Run(ctx context.Context, conn net.Conn) error {
+	if h.Encoding != nil {
+		if err := h.Encoding.validate(); err != nil {
+			return err
+		}
+	}
+
+	pingCtx, cancel := context.WithCancel(ctx)
+	defer cancel() // Run이 끝나면 Pinger도 종료
+
+	b := &beat{
+		ctx:       ctx,
+		conn:      conn,
+		maxMissed: h.maxMissed(),
+		timeout:   h.interval() * time.Duration(h.maxMissed()+1),
+		clock:     h.clock(),
+		start:     h.clock().Now(),
+		rtt:       h.window(),
+		enc:       h.Encoding,
+	}
+
+	// ctx가 취소되면 데드라인을 현재 시각으로 설정해 블로킹된 읽기와 쓰기를 깨움
+	stop := context.AfterFunc(ctx, b.interrupt)
+	defer stop()
+
+	reset := make(chan time.Duration, 1)
+	reset <- h.interval() // Pinger는 시작할 때 reset 채널에서 간격을 읽음
+	go func() {
+		// ping을 보내지 못해 Pinger가 끝나면 읽기를 중단시키고 Run이 그 에러를 반환하게 함
+		// (상대가 죽었다고 판단했거나 Run이 끝나 취소된 경우는 제외)
+		err := PingerWithOptions(pingCtx, b, reset, PingOptions{Clock: b.clock, WriteTimeout: h.interval()})
+		var pErr, msgErr *PingError
+		if !errors.As(err, &pErr) || pErr.Reason == PingCanceled || errors.Is(err, ErrPeerDead) || pingCtx.Err() != nil {
+			return // ctx가 취소되어 쓰기가 중단된 경우도 실패로 보지 않음
+		}
+		if errors.As(pErr.Err, &msgErr) {
+			pErr = msgErr // beat.Write가 Encoding의 ping 메시지를 만들지 못함
+		}
+		b.fail(pErr)
+	}()
+
+	b.extend()
+	scanner := bufio.NewScanner(conn)
+	if enc := h.Encoding; enc != nil {
+		if enc.Split != nil {
+			scanner.Split(enc.Split)
+		}
+		if enc.MaxSize > 0 {
+			scanner.Buffer(nil, enc.MaxSize) // 기본 버퍼보다 큰 메시지도 나눌 수 있도록 한도를 맞춤
+		}
+	}
+	for scanner.Scan() {
+		if enc := h.Encoding; enc != nil {
+			switch msg := scanner.Bytes(); {
+			case enc.IsPong != nil && enc.IsPong(msg): // 응답을 받았으므로 무응답 횟수를 초기화하고 데드라인 연장
+				b.pong("")
+				b.extend()
+			case enc.IsPing != nil && enc.Pong != nil && enc.IsPing(msg): // 상대의 ping에 응답
+				reply, err := enc.Pong()
+				if err == nil {
+					_, err = conn.Write(reply)
+				}
+				if err != nil && !b.stopped() && ctx.Err() == nil {
+					return err
+				}
+			case h.OnMessage != nil: // 애플리케이션 메시지
+				h.OnMessage(msg)
+			}
+			continue
+		}
+
+		line := scanner.Text()
+		switch kind, echo, _ := strings.Cut(line, " "); kind {
+		case "ping": // 상대의 ping에 순번과 타임스탬프를 그대로 담아 응답
+			reply := "pong\n"
+			if echo != "" {
+				reply = "pong " + echo + "\n"
+			}
+			if _, err := conn.Write([]byte(reply)); err != nil && !b.stopped() && ctx.Err() == nil {
+				return err
+			}
+		case "pong": // 응답을 받았으므로 무응답 횟수를 초기화하고 데드라인 연장
+			b.pong(echo)
+			b.extend()
+		default:
+			if h.OnMessage != nil {
+				h.OnMessage(scanner.Bytes())
+			}
+		}
+	}
+
+	var (
+		nErr  net.Error
+		cause error // 상대가 죽었다고 판단한 원인이 ping 쓰기 실패이면 그 *PingError
+	)
+	switch err := scanner.Err(); {
+	case b.isDead():
+	case b.failure() != nil:
+		if b.failure().Reason != PingWriteFailed {
+			return b.failure() // 메시지를 만들지 못한 것은 상대의 문제가 아님
+		}
+		cause = b.failure() // 상대가 ping을 제때 읽지 않거나 연결이 끊김
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case errors.As(err, &nErr) && nErr.Timeout(): // 데드라인까지 pong이 없었음
+	case err != nil:
+		return err
+	default:
+		return io.EOF
+	}
+
+	if h.OnDead != nil {
+		h.OnDead(conn)
+	} else {
+		_ = conn.Close()
+	}
+	if cause != nil {
+		return fmt.Errorf("%w: %w", ErrPeerDead, cause)
+	}
+	return ErrPeerDead
+}
+
+// beat는 Run 하나의 상태입니다. Pinger가 ping을 쓸 때마다 직전 ping의 응답 여부를 확인합니다.
+type beat struct {
+	ctx       context.Context
+	conn      net.Conn
+	maxMissed int
+	timeout   time.Duration
+	clock     Clock
+	start     time.Time // 타임스탬프의 기준 시각 (단조 시계를 사용하도록 경과 시간으로 보냄)
+	rtt       *rttWindow
+	enc       *HeartbeatEncoding // nil이면 텍스트 형식
+
+	mu      sync.Mutex
+	seq     uint64 // 마지막으로 보낸 ping의 순번
+	missed  int    // 연속으로 응답받지 못한 ping 수
+	waiting bool   // 마지막 ping에 대한 pong을 기다리는 중인지 여부
+	dead    bool
+	failed  *PingError // Pinger가 ping을 보내지 못하고 종료된 원인
+	sentAt  time.Time  // 마지막 ping을 보낸 시각 (enc가 있을 때 왕복 시간 계산에 사용)
+}
+
+// SetWriteDeadline은 Pinger가 ping 하나를 쓰는 동안 적용할 쓰기 데드라인을 연결에 설정합니다.
+// 이미 읽기와 쓰기를 중단시킨 뒤(상대가 죽었거나 ping을 보내지 못했거나 ctx가 취소됨)에는 데드라인을 되돌리지 않습니다.
+func (b *beat) SetWriteDeadline(t time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.dead || b.failed != nil || b.ctx.Err() != nil {
+		return nil
+	}
+	return b.conn.SetWriteDeadline(t)
+}
+
+// fail은 Pinger가 ping을 보내지 못하고 종료되었음을 기록하고 Run의 읽기 루프를 깨웁니다.
+func (b *beat) fail(err *PingError) {
+	b.mu.Lock()
+	b.failed = err
+	b.mu.Unlock()
+
+	b.interrupt()
+}
+
+// failure는 Pinger가 종료된 원인을 반환합니다. Pinger가 아직 동작 중이면 nil입니다.
+func (b *beat) failure() *PingError {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failed
+}
+
+// Write는 Pinger가 ping을 보낼 때 호출되며, Pinger가 쓴 "ping" 대신 순번과 타임스탬프를 담은 ping을 보냅니다.
+// Encoding이 설정되어 있으면 그 형식의 ping을 보냅니다.
+// 직전 ping에 대한 pong을 받지 못했으면 무응답 횟수를 늘리고, MaxMissed에 도달하면
+// 읽기를 중단시키고 에러를 반환해 Pinger를 종료합니다.
+func (b *beat) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	if b.waiting {
+		b.missed++
+	}
+	if b.missed >= b.maxMissed {
+		b.dead = true
+		b.mu.Unlock()
+		b.interrupt() // Run의 읽기 루프를 깨움
+		return 0, ErrPeerDead
+	}
+	b.waiting = true
+	b.seq++
+	b.sentAt = b.clock.Now()
+	seq := b.seq
+	b.mu.Unlock()
+
+	var ping []byte
+	if b.enc != nil {
+		msg, err := b.enc.Ping()
+		if err != nil {
+			return 0, &PingError{Reason: PingMessageFailed, Err: err}
+		}
+		ping = msg
+	} else {
+		ping = []byte(fmt.Sprintf("ping %d %d\n", seq, b.sentAt.Sub(b.start)))
+	}
+	if _, err := b.conn.Write(ping); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// pong은 pong을 받았음을 기록하고, echo에 담긴 순번과 타임스탬프로 왕복 시간을 계산합니다.
+// 보내지 않은 순번이거나 형식이 잘못된 값은 왕복 시간 계산에서 제외합니다.
+// Encoding이 설정되어 있으면 순번이 없으므로 마지막 ping을 보낸 시각부터 잽니다.
+func (b *beat) pong(echo string) {
+	b.mu.Lock()
+	waiting := b.waiting
+	b.missed, b.waiting = 0, false
+	sent, sentAt := b.seq, b.sentAt
+	b.mu.Unlock()
+
+	if b.enc != nil {
+		if waiting { // 기다리던 ping의 응답만 계산
+			b.rtt.add(b.clock.Now().Sub(sentAt))
+		}
+		return
+	}
+
+	var seq uint64
+	var ts int64
+	if n, err := fmt.Sscanf(echo, "%d %d", &seq, &ts); err != nil || n != 2 || seq == 0 || seq > sent {
+		return
+	}
+	if rtt := b.clock.Now().Sub(b.start) - time.Duration(ts); rtt >= 0 {
+		b.rtt.add(rtt)
+	}
+}
+
+// stopped는 상대가 죽었다고 판단했거나 Pinger가 ping을 보내지 못해 읽기와 쓰기를 중단시켰는지 확인합니다.
+func (b *beat) stopped() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dead || b.failed != nil
+}
+
+// isDead는 상대가 죽었다고 판단했는지 확인합니다.
+func (b *beat) isDead() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dead
+}
+
+// interrupt는 데드라인을 현재 시각으로 설정해 블로킹된 읽기와 쓰기를 깨웁니다.
+// extend와 같은 잠금을 사용하므로 연장된 데드라인이 이 설정을 덮어쓰지 않습니다.
+func (b *beat) interrupt() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_ = b.conn.SetDeadline(time.Now())
+}
+
+// extend는 읽기 데드라인을 지금부터 timeout 이후로 연장합니다.
+// 이미 읽기를 중단시킨 뒤(상대가 죽었거나 ping을 보내지 못했거나 ctx가 취소됨)에는 데드라인을 되돌리지 않습니다.
+func (b *beat) extend() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.dead || b.failed != nil || b.ctx.Err() != nil {
+		return
+	}
+	_ = b.conn.SetReadDeadline(time.Now().Add(b.timeout))
+}
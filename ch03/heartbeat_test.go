@@ -0,0 +1,364 @@
+package ch03
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/myproject/ch04"
+)
+
+// TestHeartbeatAlive는 양쪽이 서로의 ping에 응답하는 동안에는 연결이 유지되는지 테스트합니다.
+func TestHeartbeatAlive(t *testing.T) {
+	// net.Pipe는 버퍼가 없어 양쪽이 동시에 쓰면 서로를 기다리므로 실제 TCP 연결을 사용
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	server, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	dead := func(net.Conn) { t.Error("peer declared dead") }
+	errs := make(chan error, 2)
+	for _, conn := range []net.Conn{client, server} {
+		h := &Heartbeat{Interval: 10 * time.Millisecond, MaxMissed: 2, OnDead: dead}
+		go func(conn net.Conn) { errs <- h.Run(ctx, conn) }(conn)
+	}
+
+	// 두 하트비트 모두 컨텍스트의 데드라인까지 동작해야 함
+	for i := 0; i < 2; i++ {
+		if err := <-errs; !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected context deadline exceeded; actual %v", err)
+		}
+	}
+}
+
+// TestHeartbeatDeadPeer는 상대가 pong을 보내지 않으면 MaxMissed번 놓친 뒤 OnDead를 호출하는지 테스트합니다.
+func TestHeartbeatDeadPeer(t *testing.T) {
+	client, server := net.Pipe() // 메모리 내에서 연결된 한 쌍의 net.Conn 생성
+	defer client.Close()
+	defer server.Close()
+
+	// 상대는 ping을 읽기만 하고 응답하지 않음
+	pings := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(server)
+		for scanner.Scan() {
+			pings <- scanner.Text()
+		}
+	}()
+
+	called := make(chan net.Conn, 1)
+	h := &Heartbeat{
+		Interval:  10 * time.Millisecond,
+		MaxMissed: 3,
+		OnDead:    func(conn net.Conn) { called <- conn },
+	}
+
+	start := time.Now()
+	if err := h.Run(context.Background(), client); !errors.Is(err, ErrPeerDead) {
+		t.Fatalf("expected ErrPeerDead; actual %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond || elapsed > time.Second {
+		t.Errorf("unexpected detection time: %s", elapsed)
+	}
+
+	select {
+	case conn := <-called:
+		if conn != client {
+			t.Error("OnDead called with unexpected connection")
+		}
+	default:
+		t.Fatal("OnDead was not called")
+	}
+	// 마지막 ping은 읽는 고루틴이 채널로 보내기 전일 수 있으므로 잠시 기다림
+	for deadline := time.Now().Add(time.Second); len(pings) < 3 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if n := len(pings); n != 3 {
+		t.Errorf("expected 3 unanswered pings; actual %d", n)
+	}
+}
+
+// TestHeartbeatClose는 OnDead가 없으면 상대가 죽었다고 판단할 때 연결을 닫는지 테스트합니다.
+func TestHeartbeatClose(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	// 상대는 아무것도 읽지도 쓰지도 않으므로 ping 쓰기도 블로킹되지만, 읽기 데드라인으로 감지해야 함
+	h := &Heartbeat{Interval: 10 * time.Millisecond, MaxMissed: 2}
+	if err := h.Run(context.Background(), client); !errors.Is(err, ErrPeerDead) {
+		t.Fatalf("expected ErrPeerDead; actual %v", err)
+	}
+
+	if _, err := server.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected connection to be closed; actual %v", err)
+	}
+}
+
+// TestHeartbeatPeerClosed는 상대가 연결을 닫으면 io.EOF를 반환하는지 테스트합니다.
+func TestHeartbeatPeerClosed(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	_ = server.Close()
+
+	h := &Heartbeat{Interval: time.Second}
+	if err := h.Run(context.Background(), client); err != io.EOF {
+		t.Errorf("expected io.EOF; actual %v", err)
+	}
+}
+
+// TestHeartbeatRTT는 pong에 담겨 돌아온 순번과 타임스탬프로 왕복 시간을 계산하는지 테스트합니다.
+func TestHeartbeatRTT(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	// 상대는 ping의 순번과 타임스탬프를 그대로 담아 20ms 뒤에 응답
+	const delay = 20 * time.Millisecond
+	lines := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(server)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+			time.Sleep(delay)
+			if _, err := server.Write([]byte("pong" + strings.TrimPrefix(scanner.Text(), "ping") + "\n")); err != nil {
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	h := &Heartbeat{Interval: 50 * time.Millisecond, RTTWindow: 3}
+	if err := h.Run(ctx, client); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline exceeded; actual %v", err)
+	}
+
+	if first := <-lines; !strings.HasPrefix(first, "ping 1 ") {
+		t.Errorf("expected first ping with sequence 1; actual %q", first)
+	}
+
+	s := h.RTT()
+	if s.Count != 3 {
+		t.Errorf("expected 3 samples in window; actual %d", s.Count)
+	}
+	if s.Min < delay || s.Min > s.Avg || s.Avg > s.Max || s.Max > 10*delay {
+		t.Errorf("unexpected RTT stats: %+v", s)
+	}
+}
+
+// TestHeartbeatClock은 주입된 시계로 ping 간격과 왕복 시간을 재고,
+// 실제로 기다리지 않고 상대가 죽었음을 감지하는지 테스트합니다.
+func TestHeartbeatClock(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	h := &Heartbeat{Interval: time.Minute, MaxMissed: 2, Clock: clock, OnDead: func(net.Conn) {}}
+	errs := make(chan error, 1)
+	go func() { errs <- h.Run(context.Background(), client) }()
+
+	scanner := bufio.NewScanner(server)
+	tick := func() string {
+		t.Helper()
+		clock.WaitForTimer(time.Minute)
+		clock.Advance(time.Minute)
+		if !scanner.Scan() {
+			t.Fatal(scanner.Err())
+		}
+		return scanner.Text()
+	}
+
+	// 첫 ping에는 시계로 25ms가 지난 뒤 응답
+	ping := tick()
+	if ping != "ping 1 60000000000" {
+		t.Fatalf("unexpected ping: %q", ping)
+	}
+	clock.WaitForTimer(time.Minute) // Pinger가 다음 ping을 예약한 뒤에 시간을 진행
+	clock.Advance(25 * time.Millisecond)
+	if _, err := server.Write([]byte("pong" + strings.TrimPrefix(ping, "ping") + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute - 25*time.Millisecond)
+
+	// 이후의 ping에는 응답하지 않음: 두 번 놓친 뒤 다음 ping 시점에 죽었다고 판단
+	if !scanner.Scan() {
+		t.Fatal(scanner.Err())
+	}
+	tick()
+	clock.WaitForTimer(time.Minute)
+	clock.Advance(time.Minute)
+
+	if err := <-errs; !errors.Is(err, ErrPeerDead) {
+		t.Fatalf("expected ErrPeerDead; actual %v", err)
+	}
+	if s := h.RTT(); s.Count != 1 || s.Last != 25*time.Millisecond {
+		t.Errorf("expected a single 25ms sample; actual %+v", s)
+	}
+}
+
+// TestHeartbeatEncoding은 ch04 프레임 형식의 하트비트가 애플리케이션 프레임과 섞여 있어도
+// pong을 구분하고, 상대에게 프레임 형식이 아닌 데이터를 보내지 않는지 테스트합니다.
+func TestHeartbeatEncoding(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	server, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// 상대는 프레임을 하나씩 읽어 ping에 pong으로 응답하고, 그 사이에 애플리케이션 프레임도 보냄
+	isPing := MatchPayload(ch04.String("ping"))
+	pong, _ := PingPayload(ch04.String("pong"))()
+	data, _ := PingPayload(ch04.Binary(bytes.Repeat([]byte("data"), 32*1024)))() // 기본 Scanner 버퍼보다 큰 프레임
+	peerErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(server)
+		scanner.Split(ch04.ScanFrames)
+		sent := false
+		for scanner.Scan() {
+			if !isPing(scanner.Bytes()) {
+				peerErr <- fmt.Errorf("unexpected frame %q", scanner.Bytes())
+				return
+			}
+			reply := pong
+			if !sent { // 큰 프레임은 한 번만 보내 닫을 때 읽지 않은 데이터가 남지 않게 함
+				reply, sent = append(append([]byte(nil), data...), pong...), true
+			}
+			if _, err := server.Write(reply); err != nil {
+				return
+			}
+		}
+		peerErr <- scanner.Err()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	h := &Heartbeat{
+		Interval:  10 * time.Millisecond,
+		MaxMissed: 5, // 큰 프레임을 주고받느라 pong이 몇 번 늦어도 죽었다고 판단하지 않도록 여유를 둠
+		Encoding:  PayloadEncoding(ch04.String("ping"), ch04.String("pong"), ch04.ScanFrames, ch04.MaxFrameSize),
+		OnDead:    func(net.Conn) { t.Error("peer declared dead") },
+	}
+	var messages int
+	h.OnMessage = func(msg []byte) {
+		if !bytes.Equal(msg, data) {
+			t.Errorf("unexpected application frame of %d bytes", len(msg))
+		}
+		messages++
+	}
+	if err := h.Run(ctx, client); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context deadline exceeded; actual %v", err)
+	}
+	if stats := h.RTT(); stats.Count == 0 {
+		t.Error("expected round-trip samples")
+	}
+	if messages != 1 {
+		t.Errorf("expected 1 application frame; actual %d", messages)
+	}
+
+	_ = client.Close()
+	if err := <-peerErr; err != nil {
+		t.Error(err)
+	}
+}
+
+// TestHeartbeatInvalidEncoding 함수는 Ping이나 IsPong이 없는 Encoding이면 바로 에러를 반환하는지 테스트합니다.
+func TestHeartbeatInvalidEncoding(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	for _, enc := range []*HeartbeatEncoding{
+		{IsPong: MatchBytes([]byte("pong\n"))},
+		{Ping: PingBytes([]byte("ping\n"))},
+	} {
+		h := &Heartbeat{Interval: time.Millisecond, Encoding: enc}
+		if err := h.Run(context.Background(), client); err != ErrInvalidEncoding {
+			t.Errorf("expected %v; actual %v", ErrInvalidEncoding, err)
+		}
+	}
+}
+
+// TestHeartbeatWriteTimeout 함수는 상대가 ping을 읽지 않으면 ping 하나의 쓰기 데드라인이 지난 뒤
+// 읽기 타임아웃을 기다리지 않고 *PingError와 함께 상대가 죽었다고 판단하는지 테스트합니다.
+func TestHeartbeatWriteTimeout(t *testing.T) {
+	client, server := net.Pipe() // 상대가 읽지 않으면 쓰기가 블로킹됨
+	defer client.Close()
+	defer server.Close()
+
+	h := &Heartbeat{Interval: 20 * time.Millisecond, MaxMissed: 10}
+	start := time.Now()
+	err := h.Run(context.Background(), client)
+	if !errors.Is(err, ErrPeerDead) {
+		t.Fatalf("expected ErrPeerDead; actual %v", err)
+	}
+
+	var pErr *PingError
+	if !errors.As(err, &pErr) || pErr.Reason != PingWriteFailed || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected ping write timeout; actual %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond { // 읽기 타임아웃은 220ms
+		t.Errorf("expected detection by write deadline; took %s", elapsed)
+	}
+}
+
+// TestHeartbeatMessageFailed 함수는 Encoding의 ping 메시지를 만들지 못하면 그 원인을 반환하는지 테스트합니다.
+func TestHeartbeatMessageFailed(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	errBuild := errors.New("build failed")
+	h := &Heartbeat{
+		Interval: 10 * time.Millisecond,
+		Encoding: &HeartbeatEncoding{
+			Ping:   func() ([]byte, error) { return nil, errBuild },
+			IsPong: MatchBytes([]byte("pong")),
+		},
+		OnDead: func(net.Conn) { t.Error("peer declared dead") },
+	}
+
+	err := h.Run(context.Background(), client)
+	var pErr *PingError
+	if !errors.As(err, &pErr) || pErr.Reason != PingMessageFailed || !errors.Is(err, errBuild) {
+		t.Errorf("expected message failure; actual %v", err)
+	}
+}
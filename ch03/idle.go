@@ -0,0 +1,74 @@
+package ch03
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// IdleConn은 net.Conn의 읽기와 쓰기를 관찰해 데이터가 오갈 때마다 Pinger의 타이머를 다시 시작합니다.
+// 따라서 ping은 연결이 간격 동안 실제로 유휴 상태였을 때만 전송됩니다.
+//
+// 쓰기만 있고 읽기가 없어도 활동으로 보므로, 응답 없는 상대를 감지하려면 읽기 데드라인을 함께 사용해야 합니다.
+type IdleConn struct {
+	net.Conn
+
+	interval time.Duration
+	reset    chan time.Duration
+	active   atomic.Bool // 마지막으로 Active를 호출한 이후 데이터가 오갔는지 여부
+}
+
+// NewIdleConn은 conn을 감싸고 interval 동안 유휴 상태이면 ping하는 IdleConn을 생성합니다.
+// interval이 0이면 defaultPingInterval을 사용합니다.
+func NewIdleConn(conn net.Conn, interval time.Duration) *IdleConn {
+	return &IdleConn{Conn: conn, interval: interval, reset: make(chan time.Duration, 1)}
+}
+
+// Read는 데이터를 읽으면 Pinger의 타이머를 다시 시작합니다.
+func (c *IdleConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.touch()
+	}
+	return n, err
+}
+
+// Write는 데이터를 쓰면 Pinger의 타이머를 다시 시작합니다.
+func (c *IdleConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.touch()
+	}
+	return n, err
+}
+
+// Active는 마지막으로 호출한 이후 데이터가 오갔는지 반환하고 기록을 지웁니다.
+// PingOptions.Activity로 전달해 적응 모드와 함께 사용할 수 있습니다.
+func (c *IdleConn) Active() bool {
+	return c.active.Swap(false)
+}
+
+// Ping은 ctx가 취소될 때까지 연결이 유휴 상태일 때만 "ping"을 보냅니다.
+// ping은 감싼 연결에 직접 쓰므로 ping 자체는 활동으로 기록되지 않습니다.
+// 종료된 원인을 담은 *PingError를 반환합니다.
+func (c *IdleConn) Ping(ctx context.Context, opts PingOptions) error {
+	// 이미 쌓인 활동 신호 대신 시작 간격을 전달
+	select {
+	case <-c.reset:
+	default:
+	}
+	c.reset <- c.interval
+
+	return PingerWithOptions(ctx, c.Conn, c.reset, opts)
+}
+
+// touch는 활동을 기록하고 Pinger에 타이머를 다시 시작하라고 알립니다.
+// 이미 알림이 대기 중이면 Pinger가 그 알림으로 타이머를 다시 시작하므로 기다리지 않습니다.
+func (c *IdleConn) touch() {
+	c.active.Store(true)
+	select {
+	case c.reset <- 0: // 0은 간격을 유지한 채 타이머만 다시 시작
+	default:
+	}
+}
@@ -0,0 +1,86 @@
+package ch03
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestIdleConn은 읽기나 쓰기가 있으면 Pinger의 타이머가 다시 시작되어
+// 간격 동안 유휴 상태였을 때만 ping이 전송되는지 테스트합니다.
+func TestIdleConn(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := NewFakeClock(start)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	conn := NewIdleConn(client, time.Second)
+
+	// 서버는 받은 ping의 시각을 기록하고, 그 밖의 데이터는 무시
+	pings := make(chan time.Duration, 10)
+	go func() {
+		scanner := bufio.NewScanner(server)
+		for scanner.Scan() {
+			if scanner.Text() == "ping" {
+				pings <- clock.Now().Sub(start)
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_ = conn.Ping(ctx, PingOptions{Clock: clock})
+		close(done)
+	}()
+
+	expectPing := func(at time.Duration) {
+		t.Helper()
+		select {
+		case sent := <-pings:
+			if sent != at {
+				t.Errorf("expected ping at %s; actual %s", at, sent)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected ping at %s", at)
+		}
+	}
+
+	clock.WaitForTimer(time.Second)
+	clock.Advance(time.Second)
+	expectPing(time.Second)
+	if conn.Active() {
+		t.Error("ping should not count as activity")
+	}
+
+	// 쓰기가 있으면 그 시점부터 다시 1초를 기다림
+	clock.WaitForTimer(time.Second)
+	clock.Advance(500 * time.Millisecond)
+	if _, err := conn.Write([]byte("data\n")); err != nil {
+		t.Fatal(err)
+	}
+	clock.WaitForTimer(time.Second)
+	clock.Advance(time.Second)
+	expectPing(2500 * time.Millisecond)
+
+	// 읽기도 활동으로 기록
+	clock.WaitForTimer(time.Second)
+	clock.Advance(700 * time.Millisecond)
+	go func() { _, _ = server.Write([]byte("x")) }()
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	clock.WaitForTimer(time.Second)
+	clock.Advance(time.Second)
+	expectPing(4200 * time.Millisecond)
+
+	if !conn.Active() || conn.Active() {
+		t.Error("expected Active to report and clear activity")
+	}
+
+	cancel()
+	<-done
+}
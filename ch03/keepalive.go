@@ -0,0 +1,398 @@
+package ch03
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultKeepaliveWriteTimeout = 5 * time.Second // ping 하나를 쓰는 데 기다리는 기본 시간
+	defaultKeepaliveWorkers      = 16              // 동시에 ping을 쓰는 기본 고루틴 수
+)
+
+// ErrNotRegistered는 KeepaliveManager에 등록되지 않은 연결을 사용할 때 반환됩니다.
+var ErrNotRegistered = errors.New("connection not registered")
+
+// DeadConn은 KeepaliveManager가 죽었다고 판단한 연결과 그 사유입니다.
+type DeadConn struct {
+	Conn net.Conn
+	Err  error // ErrPeerDead이거나 ping을 쓰다 발생한 에러
+}
+
+// KeepaliveManager는 등록된 모든 연결의 ping을 고루틴 하나와 타이머 하나로 예약합니다.
+// 연결마다 Pinger 고루틴을 두는 대신 다음 ping 시각을 힙으로 관리하므로 연결이 많아도 비용이 적습니다.
+//
+// 연결을 읽는 쪽은 애플리케이션이므로, pong(또는 상대가 살아 있다는 다른 신호)을 받으면 Pong을 호출해야 합니다.
+// ping을 MaxMissed번 연속으로 보내는 동안 Pong이 없거나 ping을 쓰지 못하면 연결을 등록 해제하고
+// Dead 채널로 알립니다. ping은 Workers개의 고루틴이 나눠 쓰므로 쓰기가 막힌 연결이 다른 연결의 예약을 지연시키지 않으며,
+// 이전 ping을 아직 쓰고 있는 연결에는 새 ping을 보내지 않고 무응답으로 셉니다.
+//
+// 막힌 쓰기가 작업 고루틴을 붙잡지 않도록 ping마다 연결의 쓰기 데드라인을 WriteTimeout 뒤로 설정하고
+// 쓰기가 끝나면 해제합니다. 이 작업은 애플리케이션의 쓰기와 동시에 일어나므로, 애플리케이션이 등록한 연결에
+// 설정한 쓰기 데드라인은 사라지고 ping을 쓰는 동안에는 애플리케이션의 쓰기에도 ping의 데드라인이 적용됩니다.
+// 등록한 연결에는 자신의 쓰기 데드라인을 두지 않아야 합니다.
+type KeepaliveManager struct {
+	Interval     time.Duration // Register에 간격을 주지 않았을 때의 ping 간격 (0이면 defaultPingInterval)
+	MaxMissed    int           // 죽었다고 판단할 연속 무응답 횟수 (0이면 defaultMaxMissed)
+	WriteTimeout time.Duration // ping 하나를 쓰는 제한 시간, 연결의 쓰기 데드라인을 덮어씀 (0이면 defaultKeepaliveWriteTimeout)
+	Workers      int           // 동시에 ping을 쓰는 최대 고루틴 수 (0이면 defaultKeepaliveWorkers)
+	Message      PingMessage   // 보낼 ping (nil이면 "ping\n")
+	Clock        Clock         // nil이면 RealClock
+
+	// Dead가 설정되면 죽은 연결을 이 채널로 보내고, 설정되지 않으면 연결을 닫음
+	// 별도의 고루틴이 순서대로 보내므로 채널을 늦게 읽어도 ping 예약은 지연되지 않음
+	Dead chan<- DeadConn
+
+	initOnce sync.Once
+	mu       sync.Mutex
+	queue    keepaliveQueue               // 다음 ping 시각 순서의 힙
+	conns    map[net.Conn]*keepaliveEntry // 등록된 연결
+	wake     chan struct{}                // 가장 이른 ping 시각이 바뀌었음을 Run에 알림
+	writes   []*keepaliveEntry            // ping을 써야 하는 연결 (작업 고루틴이 차례로 가져감)
+	work     chan struct{}                // writes에 연결이 추가되었음을 작업 고루틴에 알림
+	dead     []DeadConn                   // 아직 Dead로 보내지 못한 죽은 연결
+	deadWake chan struct{}                // dead에 연결이 추가되었음을 전달 고루틴에 알림
+}
+
+// keepaliveEntry는 등록된 연결 하나의 상태입니다. KeepaliveManager.mu로 보호합니다.
+type keepaliveEntry struct {
+	conn     net.Conn
+	interval time.Duration
+	next     time.Time // 다음 ping 시각
+	missed   int       // 연속으로 응답받지 못한 ping 수
+	waiting  bool      // 마지막 ping에 대한 pong을 기다리는 중인지 여부
+	writing  bool      // ping을 쓰는 중이거나 쓰기를 기다리는 중인지 여부
+	index    int       // 힙에서의 위치
+}
+
+func (m *KeepaliveManager) init() {
+	m.initOnce.Do(func() {
+		m.conns = make(map[net.Conn]*keepaliveEntry)
+		m.wake = make(chan struct{}, 1)
+		m.work = make(chan struct{}, 1)
+		m.deadWake = make(chan struct{}, 1)
+	})
+}
+
+// clock은 실제로 사용할 시계를 반환합니다.
+func (m *KeepaliveManager) clock() Clock {
+	if m.Clock != nil {
+		return m.Clock
+	}
+	return RealClock
+}
+
+// maxMissed는 실제로 적용할 연속 무응답 허용 횟수를 반환합니다.
+func (m *KeepaliveManager) maxMissed() int {
+	if m.MaxMissed > 0 {
+		return m.MaxMissed
+	}
+	return defaultMaxMissed
+}
+
+// writeTimeout은 실제로 적용할 쓰기 제한 시간을 반환합니다.
+func (m *KeepaliveManager) writeTimeout() time.Duration {
+	if m.WriteTimeout > 0 {
+		return m.WriteTimeout
+	}
+	return defaultKeepaliveWriteTimeout
+}
+
+// workers는 실제로 사용할 작업 고루틴 수를 반환합니다.
+func (m *KeepaliveManager) workers() int {
+	if m.Workers > 0 {
+		return m.Workers
+	}
+	return defaultKeepaliveWorkers
+}
+
+// Register는 conn을 interval마다 ping하도록 등록합니다. interval이 0이면 Interval을 사용합니다.
+// 이미 등록된 연결이면 간격을 바꾸고 지금부터 다시 예약합니다.
+func (m *KeepaliveManager) Register(conn net.Conn, interval time.Duration) {
+	m.init()
+	if interval <= 0 {
+		interval = m.Interval
+	}
+	if interval <= 0 {
+		interval = defaultPingInterval
+	}
+
+	m.mu.Lock()
+	e, ok := m.conns[conn]
+	if !ok {
+		e = &keepaliveEntry{conn: conn}
+		m.conns[conn] = e
+	}
+	e.interval = interval
+	e.next = m.clock().Now().Add(interval)
+	if ok {
+		heap.Fix(&m.queue, e.index)
+	} else {
+		heap.Push(&m.queue, e)
+	}
+	m.mu.Unlock()
+
+	m.notify()
+}
+
+// Unregister는 conn의 ping을 중단합니다. 등록되지 않은 연결이면 ErrNotRegistered를 반환합니다.
+func (m *KeepaliveManager) Unregister(conn net.Conn) error {
+	m.init()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.conns[conn]
+	if !ok {
+		return ErrNotRegistered
+	}
+	m.remove(e)
+	return nil
+}
+
+// Pong은 conn의 상대가 응답했음을 기록해 무응답 횟수를 초기화합니다.
+// 등록되지 않은 연결이면 ErrNotRegistered를 반환합니다.
+func (m *KeepaliveManager) Pong(conn net.Conn) error {
+	m.init()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.conns[conn]
+	if !ok {
+		return ErrNotRegistered
+	}
+	e.missed, e.waiting = 0, false
+	return nil
+}
+
+// Len은 등록된 연결 수를 반환합니다.
+func (m *KeepaliveManager) Len() int {
+	m.init()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.conns)
+}
+
+// Run은 ctx가 취소될 때까지 등록된 연결에 ping을 보내며, 항상 ctx.Err()를 반환합니다.
+// 반환하기 전에 쓰는 중인 ping이 끝날 때까지 기다립니다.
+func (m *KeepaliveManager) Run(ctx context.Context) error {
+	m.init()
+	clock := m.clock()
+	message := m.Message
+	if message == nil {
+		message = defaultPingMessage
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; i < m.workers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.writer(ctx, message)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.deliver(ctx)
+	}()
+
+	timer := clock.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		// 가장 이른 ping 시각에 맞춰 타이머를 다시 예약 (등록된 연결이 없으면 wake를 기다림)
+		if !timer.Stop() {
+			select {
+			case <-timer.C():
+			default:
+			}
+		}
+		m.mu.Lock()
+		if len(m.queue) > 0 {
+			_ = timer.Reset(m.queue[0].next.Sub(clock.Now()))
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.wake:
+			continue
+		case <-timer.C():
+		}
+
+		m.ping(clock)
+	}
+}
+
+// ping은 ping 시각이 된 연결을 작업 고루틴에 넘기고, 죽었다고 판단한 연결을 등록 해제합니다.
+// 쓰기는 기다리지 않으므로 예약은 쓰기가 막힌 연결의 영향을 받지 않습니다.
+func (m *KeepaliveManager) ping(clock Clock) {
+	now := clock.Now()
+	queued := false
+
+	m.mu.Lock()
+	for len(m.queue) > 0 && !m.queue[0].next.After(now) {
+		e := m.queue[0]
+		if e.waiting {
+			e.missed++
+		}
+		if e.missed >= m.maxMissed() {
+			m.remove(e)
+			m.report(DeadConn{Conn: e.conn, Err: ErrPeerDead})
+			continue
+		}
+		e.waiting = true
+		e.next = now.Add(e.interval)
+		heap.Fix(&m.queue, 0)
+		if !e.writing { // 이전 ping을 아직 쓰고 있으면 이번 ping은 보내지 않음
+			e.writing = true
+			m.writes = append(m.writes, e)
+			queued = true
+		}
+	}
+	m.mu.Unlock()
+
+	if queued {
+		signal(m.work)
+	}
+}
+
+// writer는 ctx가 취소될 때까지 writes에서 연결을 하나씩 가져와 ping을 씁니다.
+// 쓰기에 실패한 연결은 등록 해제하고 Dead로 알립니다.
+func (m *KeepaliveManager) writer(ctx context.Context, message PingMessage) {
+	for {
+		m.mu.Lock()
+		if len(m.writes) == 0 {
+			m.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.work:
+				continue
+			}
+		}
+		e := m.writes[0]
+		m.writes[0] = nil
+		m.writes = m.writes[1:]
+		more := len(m.writes) > 0
+		registered := m.conns[e.conn] == e
+		m.mu.Unlock()
+		if more {
+			signal(m.work) // 남은 연결은 다른 작업 고루틴이 가져가도록 함
+		}
+
+		// 잠금을 푼 상태로 써서 쓰는 동안에도 Pong과 Register를 처리할 수 있도록 함
+		var err error
+		if registered { // 기다리는 동안 등록 해제된 연결에는 쓰지 않음
+			err = m.write(e.conn, message)
+		}
+
+		m.mu.Lock()
+		e.writing = false
+		if err != nil && m.conns[e.conn] == e { // 쓰는 동안 등록 해제된 연결은 알리지 않음
+			m.remove(e)
+			m.report(DeadConn{Conn: e.conn, Err: err})
+		}
+		m.mu.Unlock()
+	}
+}
+
+// deliver는 ctx가 취소될 때까지 죽은 연결을 차례로 Dead에 보내거나, Dead가 없으면 닫습니다.
+func (m *KeepaliveManager) deliver(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.deadWake:
+		}
+
+		m.mu.Lock()
+		dead := m.dead
+		m.dead = nil
+		m.mu.Unlock()
+
+		for i, d := range dead {
+			if m.Dead == nil {
+				_ = d.Conn.Close()
+				continue
+			}
+			select {
+			case m.Dead <- d:
+			case <-ctx.Done():
+				// 보내지 못한 연결은 다음 Run에서 보내도록 되돌려 둠
+				m.mu.Lock()
+				m.dead = append(dead[i:], m.dead...)
+				m.mu.Unlock()
+				signal(m.deadWake)
+				return
+			}
+		}
+	}
+}
+
+// report는 죽은 연결을 전달 고루틴에 넘깁니다. m.mu를 잠근 상태에서 호출해야 합니다.
+func (m *KeepaliveManager) report(d DeadConn) {
+	m.dead = append(m.dead, d)
+	signal(m.deadWake)
+}
+
+// write는 WriteTimeout 안에 conn에 ping 하나를 씁니다. conn의 쓰기 데드라인을 덮어쓰고 끝나면 해제합니다.
+func (m *KeepaliveManager) write(conn net.Conn, message PingMessage) error {
+	msg, err := message()
+	if err != nil {
+		return err
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(m.writeTimeout()))
+	defer func() { _ = conn.SetWriteDeadline(time.Time{}) }()
+
+	_, err = conn.Write(msg)
+	return err
+}
+
+// remove는 e를 등록 해제합니다. m.mu를 잠근 상태에서 호출해야 합니다.
+func (m *KeepaliveManager) remove(e *keepaliveEntry) {
+	heap.Remove(&m.queue, e.index)
+	delete(m.conns, e.conn)
+}
+
+// notify는 예약이 바뀌었음을 Run에 알립니다.
+func (m *KeepaliveManager) notify() { signal(m.wake) }
+
+// signal은 크기가 1인 알림 채널에 신호를 보냅니다. 이미 알림이 대기 중이면 기다리지 않습니다.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// keepaliveQueue는 다음 ping 시각이 이른 순서로 정렬하는 container/heap 구현입니다.
+type keepaliveQueue []*keepaliveEntry
+
+func (q keepaliveQueue) Len() int           { return len(q) }
+func (q keepaliveQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+
+func (q keepaliveQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index, q[j].index = i, j
+}
+
+func (q *keepaliveQueue) Push(x any) {
+	e := x.(*keepaliveEntry)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *keepaliveQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,183 @@
+package ch03
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// keepaliveConn은 쓰인 ping을 기록하는 테스트용 net.Conn입니다.
+type keepaliveConn struct {
+	net.Conn
+	name   string
+	clock  Clock
+	writes chan<- string
+	err    error         // 설정되면 Write가 이 에러를 반환
+	block  chan struct{} // 설정되면 Write가 이 채널이 닫힐 때까지 멈춤
+}
+
+func (c *keepaliveConn) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.block != nil {
+		<-c.block
+		return len(p), nil
+	}
+	c.writes <- c.name + "@" + c.clock.Now().Sub(time.Unix(0, 0)).String()
+	return len(p), nil
+}
+
+func (c *keepaliveConn) SetWriteDeadline(time.Time) error { return nil }
+
+// TestKeepaliveManager는 연결마다 다른 간격으로 ping을 예약하고, 응답이 없는 연결과
+// 쓰기에 실패한 연결을 Dead 채널로 알리는지 테스트합니다.
+func TestKeepaliveManager(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	writes := make(chan string, 10)
+	dead := make(chan DeadConn, 10)
+	a := &keepaliveConn{name: "a", clock: clock, writes: writes}
+	b := &keepaliveConn{name: "b", clock: clock, writes: writes}
+	c := &keepaliveConn{name: "c", clock: clock, writes: writes, err: errors.New("broken pipe")}
+
+	m := &KeepaliveManager{MaxMissed: 2, Clock: clock, Dead: dead}
+	m.Register(a, time.Second)
+	m.Register(b, 3*time.Second)
+	m.Register(c, 2*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+
+	// step은 d만큼 시간을 흘리고 그 사이에 쓰인 ping을 확인 (같은 시각의 ping은 순서를 보장하지 않음)
+	step := func(d time.Duration, want ...string) {
+		t.Helper()
+		clock.WaitForTimer(d)
+		clock.Advance(d)
+		var got []string
+		for range want {
+			select {
+			case w := <-writes:
+				got = append(got, w)
+			case <-time.After(time.Second):
+				t.Fatalf("expected pings %v; actual %v", want, got)
+			}
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected pings %v; actual %v", want, got)
+		}
+	}
+	expectDead := func(conn net.Conn, reason error) {
+		t.Helper()
+		select {
+		case d := <-dead:
+			if d.Conn != conn || !errors.Is(d.Err, reason) {
+				t.Errorf("unexpected dead connection: %+v", d)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected dead connection")
+		}
+	}
+
+	step(time.Second, "a@1s")
+	if err := m.Pong(a); err != nil { // a는 응답했으므로 무응답 횟수가 초기화됨
+		t.Fatal(err)
+	}
+	step(time.Second, "a@2s")
+	expectDead(c, c.err) // c는 첫 ping을 쓰지 못함
+	step(time.Second, "a@3s", "b@3s")
+	if err := m.Pong(b); err != nil {
+		t.Fatal(err)
+	}
+	// a는 2초와 3초의 ping에 응답하지 않았으므로 4초에 죽었다고 판단
+	clock.WaitForTimer(time.Second)
+	clock.Advance(time.Second)
+	expectDead(a, ErrPeerDead)
+
+	if n := m.Len(); n != 1 {
+		t.Errorf("expected 1 registered connection; actual %d", n)
+	}
+	if err := m.Pong(a); !errors.Is(err, ErrNotRegistered) {
+		t.Errorf("expected ErrNotRegistered; actual %v", err)
+	}
+
+	// 간격을 바꾸면 지금부터 다시 예약
+	m.Register(b, 500*time.Millisecond)
+	step(500*time.Millisecond, "b@4.5s")
+	if err := m.Unregister(b); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context canceled; actual %v", err)
+	}
+	if len(writes) != 0 || len(dead) != 0 {
+		t.Errorf("unexpected extra events: %d writes, %d dead", len(writes), len(dead))
+	}
+}
+
+// TestKeepaliveManagerBlocked는 쓰기가 막힌 연결과 읽지 않는 Dead 채널이
+// 다른 연결의 ping을 지연시키지 않는지 테스트합니다.
+func TestKeepaliveManagerBlocked(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	writes := make(chan string, 10)
+	dead := make(chan DeadConn) // 테스트가 끝날 때까지 읽지 않음
+	block := make(chan struct{})
+	a := &keepaliveConn{name: "a", clock: clock, writes: writes}
+	slow := &keepaliveConn{name: "slow", clock: clock, writes: writes, block: block}
+	broken := &keepaliveConn{name: "broken", clock: clock, writes: writes, err: errors.New("broken pipe")}
+
+	m := &KeepaliveManager{MaxMissed: 2, Clock: clock, Dead: dead}
+	m.Register(a, time.Second)
+	m.Register(slow, time.Second)
+	m.Register(broken, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+
+	// slow의 첫 ping은 끝나지 않고 broken은 죽지만, a의 ping은 제시간에 계속 쓰여야 함
+	for i := 1; i <= 4; i++ {
+		clock.WaitForTimer(time.Second)
+		clock.Advance(time.Second)
+		want := "a@" + (time.Duration(i) * time.Second).String()
+		select {
+		case w := <-writes:
+			if w != want {
+				t.Errorf("expected ping %q; actual %q", want, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected ping %q", want)
+		}
+		if err := m.Pong(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 쓰는 중인 slow에는 ping을 더 보내지 않고 무응답으로 세어 3초에 죽었다고 판단
+	if n := m.Len(); n != 1 {
+		t.Errorf("expected 1 registered connection; actual %d", n)
+	}
+	for _, want := range []DeadConn{{Conn: broken, Err: broken.err}, {Conn: slow, Err: ErrPeerDead}} {
+		select {
+		case d := <-dead:
+			if d.Conn != want.Conn || !errors.Is(d.Err, want.Err) {
+				t.Errorf("expected dead %+v; actual %+v", want, d)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected dead connection")
+		}
+	}
+
+	close(block)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context canceled; actual %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package ch03
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// PingMessage는 하트비트로 보낼 메시지 하나를 만듭니다.
+// 반환한 메시지는 한 번의 Write로 쓰므로 다른 고루틴이 쓰는 프레임 사이에 끼어들지 않습니다.
+type PingMessage func() ([]byte, error)
+
+// PingBytes는 항상 b를 보내는 PingMessage를 반환합니다.
+func PingBytes(b []byte) PingMessage {
+	return func() ([]byte, error) { return b, nil }
+}
+
+// PingFunc는 보낼 때마다 f를 호출해 메시지를 만드는 PingMessage를 반환합니다.
+func PingFunc(f func() []byte) PingMessage {
+	return func() ([]byte, error) { return f(), nil }
+}
+
+// PingPayload는 p를 WriteTo로 인코딩한 메시지를 보내는 PingMessage를 반환합니다.
+// ch04의 Payload처럼 헤더와 데이터를 나누어 쓰는 값도 버퍼에 모아 한 번에 보냅니다.
+func PingPayload(p io.WriterTo) PingMessage {
+	return func() ([]byte, error) {
+		var buf bytes.Buffer
+		if _, err := p.WriteTo(&buf); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+// MessageMatcher는 수신 스트림에서 나눈 메시지 하나가 특정 하트비트 메시지인지 확인합니다.
+type MessageMatcher func(msg []byte) bool
+
+// MatchBytes는 b와 같은 메시지와 일치하는 MessageMatcher를 반환합니다.
+func MatchBytes(b []byte) MessageMatcher {
+	return func(msg []byte) bool { return bytes.Equal(msg, b) }
+}
+
+// MatchPayload는 p를 WriteTo로 인코딩한 결과와 같은 메시지와 일치하는 MessageMatcher를 반환합니다.
+// 인코딩에 실패하면 어떤 메시지와도 일치하지 않습니다.
+func MatchPayload(p io.WriterTo) MessageMatcher {
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil {
+		return func([]byte) bool { return false }
+	}
+	return MatchBytes(buf.Bytes())
+}
+
+// HeartbeatEncoding은 Heartbeat가 기본 텍스트 형식("ping <순번> <타임스탬프>") 대신 주고받을 메시지 형식입니다.
+// 순번을 담을 수 없으므로 왕복 시간은 마지막 ping을 보낸 뒤 pong을 받을 때까지의 시간으로 잽니다.
+type HeartbeatEncoding struct {
+	Ping   PingMessage    // 보낼 ping
+	IsPong MessageMatcher // 받은 메시지가 pong인지 확인
+
+	// Pong과 IsPing이 모두 설정되면 상대가 보낸 ping에 Pong으로 응답함
+	Pong   PingMessage
+	IsPing MessageMatcher
+
+	Split   bufio.SplitFunc // 수신 스트림을 메시지로 나누는 함수 (nil이면 bufio.ScanLines)
+	MaxSize int             // Split이 나누는 메시지 하나의 최대 크기 (0이면 bufio.MaxScanTokenSize)
+}
+
+// PayloadEncoding은 ping과 pong Payload를 주고받는 HeartbeatEncoding을 반환합니다.
+// ch04 프레임을 사용하는 스트림이면 split으로 ch04.ScanFrames를, maxSize로 ch04.MaxFrameSize를 전달합니다.
+func PayloadEncoding(ping, pong io.WriterTo, split bufio.SplitFunc, maxSize int) *HeartbeatEncoding {
+	return &HeartbeatEncoding{
+		Ping:    PingPayload(ping),
+		IsPong:  MatchPayload(pong),
+		Pong:    PingPayload(pong),
+		IsPing:  MatchPayload(ping),
+		Split:   split,
+		MaxSize: maxSize,
+	}
+}
+
+// validate는 ping을 보내고 pong을 확인하는 데 필요한 값이 모두 설정되어 있는지 확인합니다.
+func (e *HeartbeatEncoding) validate() error {
+	if e.Ping == nil || e.IsPong == nil {
+		return ErrInvalidEncoding
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package ch03
+
+import (
+	"bytes"
+	"testing"
+
+	"example.com/myproject/ch04"
+)
+
+// TestPingPayload는 ch04 Payload를 한 번의 Write로 보낼 프레임으로 인코딩하고, 같은 프레임과 일치하는지 테스트합니다.
+func TestPingPayload(t *testing.T) {
+	var want bytes.Buffer
+	if _, err := ch04.String("ping").WriteTo(&want); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := PingPayload(ch04.String("ping"))()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg, want.Bytes()) {
+		t.Errorf("expected %q; actual %q", want.Bytes(), msg)
+	}
+
+	match := MatchPayload(ch04.String("ping"))
+	if !match(want.Bytes()) {
+		t.Error("expected encoded payload to match")
+	}
+	if match(msg[:len(msg)-1]) || match([]byte("ping")) {
+		t.Error("unexpected match")
+	}
+
+	n := 0
+	f := PingFunc(func() []byte { n++; return []byte{byte(n)} })
+	if a, _ := f(); a[0] != 1 {
+		t.Errorf("expected first message 1; actual %d", a[0])
+	}
+	if b, _ := f(); b[0] != 2 {
+		t.Errorf("expected second message 2; actual %d", b[0])
+	}
+}
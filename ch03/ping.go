@@ -3,6 +3,7 @@ package ch03
 import (
 	"context"
 	"io"
+	"math/rand/v2"
 	"time"
 )
 
@@ -11,45 +12,205 @@ const defaultPingInterval = 30 * time.Second
 // Pinger는 주어진 시간 간격(interval)마다 "ping" 메시지를 io.Writer에 작성합니다.
 // ctx가 취소되거나 reset 채널을 통해 새로운 간격이 전달될 때까지 계속 동작합니다.
 func Pinger(ctx context.Context, w io.Writer, reset <-chan time.Duration) {
-	var interval time.Duration
+	PingerWithClock(ctx, RealClock, w, reset)
+}
+
+// PingerWithClock은 clock의 타이머를 사용하는 Pinger입니다.
+// FakeClock을 전달하면 실제로 기다리지 않고 간격과 reset 동작을 테스트할 수 있습니다.
+// 종료된 원인이 필요하면 PingerWithOptions를 사용합니다.
+func PingerWithClock(ctx context.Context, clock Clock, w io.Writer, reset <-chan time.Duration) {
+	_ = PingerWithOptions(ctx, w, reset, PingOptions{Clock: clock})
+}
+
+// PingOptions는 Pinger의 간격을 정하는 방식을 설정합니다. 값이 0인 PingOptions는 Pinger와 같게 동작합니다.
+type PingOptions struct {
+	Clock Clock // 타이머에 사용할 시계 (nil이면 RealClock)
+
+	// Jitter는 매 간격을 무작위로 흔드는 비율입니다 (0~1).
+	// 0.1이면 간격의 90%~110% 사이에서 기다리므로, 동시에 연결된 많은 클라이언트가 같은 순간에 ping하지 않음
+	Jitter float64
+
+	// Activity가 설정되면 적응 모드로 동작합니다. ping할 때마다 호출해 직전 간격 동안
+	// 애플리케이션 트래픽이 있었는지 확인하고, 있었으면 간격을 두 배로 늘리고(MaxInterval까지)
+	// 없었으면 기본 간격으로 되돌림
+	Activity func() bool
+
+	// MaxInterval은 적응 모드에서 늘어날 수 있는 최대 간격입니다 (0이면 기본 간격의 defaultMaxIntervalFactor배)
+	MaxInterval time.Duration
+
+	// WriteTimeout이 설정되면 w가 SetWriteDeadline을 지원할 때(net.Conn 등) ping 하나를 쓰는 제한 시간입니다.
+	// ping을 쓰는 동안 연결의 쓰기 데드라인을 덮어쓰고 쓰기가 끝나면 해제하므로, 애플리케이션이 같은 연결에
+	// 설정한 쓰기 데드라인은 사라지고 그동안 애플리케이션의 쓰기에도 이 데드라인이 적용됨
+	// 0이면 데드라인을 건드리지 않고 제한 없이 씀
+	WriteTimeout time.Duration
+
+	// Message는 보낼 하트비트 메시지입니다 (nil이면 "ping\n")
+	// 프레임 프로토콜을 사용하는 스트림에서는 PingPayload로 프레임 형식의 메시지를 보냄
+	Message PingMessage
+}
+
+// PingStopReason은 Pinger가 종료된 원인입니다.
+type PingStopReason uint8
+
+// Pinger 종료 원인 정의
+const (
+	PingCanceled      PingStopReason = iota + 1 // 1 (ctx가 취소됨)
+	PingMessageFailed                           // 2 (ping 메시지를 만들지 못함)
+	PingWriteFailed                             // 3 (ping을 쓰지 못함, 쓰기 데드라인 초과 포함)
+)
+
+func (r PingStopReason) String() string {
+	switch r {
+	case PingCanceled:
+		return "canceled"
+	case PingMessageFailed:
+		return "message failed"
+	case PingWriteFailed:
+		return "write failed"
+	}
+	return "unknown"
+}
+
+// PingError는 PingerWithOptions가 종료된 원인과 그 에러입니다.
+type PingError struct {
+	Reason PingStopReason
+	Err    error // ctx.Err()이거나 메시지 생성 또는 쓰기에서 발생한 에러
+}
+
+func (e *PingError) Error() string { return "pinger " + e.Reason.String() + ": " + e.Err.Error() }
+
+// Unwrap은 원인 에러를 반환하므로 errors.Is(err, context.Canceled) 등으로 확인할 수 있습니다.
+func (e *PingError) Unwrap() error { return e.Err }
+
+// defaultPingMessage는 PingOptions.Message가 없을 때 보내는 메시지입니다.
+var defaultPingMessage = PingBytes([]byte("ping\n"))
+
+const defaultMaxIntervalFactor = 8 // 적응 모드에서 MaxInterval이 없을 때 기본 간격 대비 최대 간격 배수
+
+// PingerWithOptions는 opts에 따라 간격에 지터를 더하거나 트래픽에 맞춰 간격을 조절하는 Pinger입니다.
+// reset 채널로 전달된 간격은 기본 간격이 되며, 적응 모드에서 늘어난 간격도 이 값으로 되돌립니다.
+// 종료된 원인을 담은 *PingError를 반환합니다.
+func PingerWithOptions(ctx context.Context, w io.Writer, reset <-chan time.Duration, opts PingOptions) error {
+	clock := opts.Clock
+	if clock == nil {
+		clock = RealClock
+	}
+	sched := &pingSchedule{opts: opts, rand: rand.Float64}
+	message := opts.Message
+	if message == nil {
+		message = defaultPingMessage
+	}
 
 	// 초기화 단계에서 컨텍스트가 완료되었거나, reset 채널에서 새로운 간격이 전달된 경우 처리
 	select {
 	case <-ctx.Done():  // 컨텍스트가 완료된 경우
-		return
-	case interval = <-reset:  // reset 채널에서 새로운 간격이 전달된 경우
+		return &PingError{Reason: PingCanceled, Err: ctx.Err()}
+	case interval := <-reset:  // reset 채널에서 새로운 간격이 전달된 경우
+		sched.setBase(interval)
 	default:
-	}
-
-	// interval이 0으로 설정되면 기본 간격을 사용
-	if interval == 0 {
-		interval = defaultPingInterval
+		sched.setBase(0)
 	}
 
 	// 타이머를 설정하고, 함수가 끝날 때 타이머를 정리
-	timer := time.NewTimer(interval)
+	timer := clock.NewTimer(sched.wait())
 	defer func() {
 		if !timer.Stop() {  // 타이머를 정리
-			<-timer.C  // 타이머 채널을 읽어버려서 타이머의 잔여 이벤트를 소모
+			// 타이머 채널에 남은 이벤트가 있으면 소모 (쓰기 실패로 끝난 경우에는 이미 소모했으므로 기다리지 않음)
+			select {
+			case <-timer.C():
+			default:
+			}
 		}
 	}()
 
 	for {
 		select {
 		case <-ctx.Done():  // 컨텍스트가 완료되면 루프 종료
-			return
+			return &PingError{Reason: PingCanceled, Err: ctx.Err()}
 		case newInterval := <-reset:  // reset 채널에서 새로운 간격이 전달된 경우
 			if !timer.Stop() {  // 기존 타이머 정리
-				<-timer.C  // 타이머 채널을 읽어버려서 타이머의 잔여 이벤트를 소모
+				<-timer.C()  // 타이머 채널을 읽어버려서 타이머의 잔여 이벤트를 소모
 			}
 			if newInterval > 0 {
-				interval = newInterval  // 새로운 간격으로 업데이트
+				sched.setBase(newInterval)  // 새로운 간격으로 업데이트
 			}
-		case <-timer.C:  // 타이머가 만료되면 "ping" 메시지 작성
-			if _, err := w.Write([]byte("ping\n")); err != nil {
-				return  // 오류 발생 시 루프 종료
+		case <-timer.C():  // 타이머가 만료되면 ping 메시지 작성
+			msg, err := message()
+			if err != nil {
+				return &PingError{Reason: PingMessageFailed, Err: err}  // 메시지를 만들지 못하면 루프 종료
 			}
+			if err := writePing(w, msg, opts.WriteTimeout); err != nil {
+				return &PingError{Reason: PingWriteFailed, Err: err}  // 오류 발생 시 루프 종료
+			}
+			sched.adapt()  // 적응 모드이면 직전 간격의 트래픽에 따라 간격 조절
 		}
-		_ = timer.Reset(interval)  // 타이머를 새로운 간격으로 리셋
+		_ = timer.Reset(sched.wait())  // 타이머를 새로운 간격으로 리셋
+	}
+}
+
+// writeDeadliner는 쓰기 데드라인을 설정할 수 있는 io.Writer입니다 (net.Conn 등).
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// writePing은 msg를 w에 씁니다. timeout이 0보다 크고 w가 쓰기 데드라인을 지원하면 timeout 안에 쓰지 못할 때 에러를 반환합니다.
+// 데드라인은 운영체제가 처리하므로 주입된 시계가 아닌 실제 시간을 사용합니다.
+func writePing(w io.Writer, msg []byte, timeout time.Duration) error {
+	if d, ok := w.(writeDeadliner); ok && timeout > 0 {
+		_ = d.SetWriteDeadline(time.Now().Add(timeout))  // 데드라인을 지원하지 않으면 제한 없이 씀
+		defer func() { _ = d.SetWriteDeadline(time.Time{}) }()
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+// pingSchedule은 Pinger가 다음 ping까지 기다릴 시간을 계산합니다.
+type pingSchedule struct {
+	opts    PingOptions
+	rand    func() float64 // [0, 1) 범위의 난수
+	base    time.Duration  // reset 채널로 정한 기본 간격
+	current time.Duration  // 적응 모드에서 조절된 현재 간격
+}
+
+// setBase는 기본 간격을 바꾸고 현재 간격을 기본 간격으로 되돌립니다. 0이면 defaultPingInterval을 사용합니다.
+func (s *pingSchedule) setBase(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultPingInterval
+	}
+	s.base, s.current = interval, interval
+}
+
+// maxInterval은 적응 모드에서 늘어날 수 있는 최대 간격을 반환합니다.
+func (s *pingSchedule) maxInterval() time.Duration {
+	if s.opts.MaxInterval > 0 {
+		return max(s.opts.MaxInterval, s.base)
+	}
+	return s.base * defaultMaxIntervalFactor
+}
+
+// adapt는 직전 간격 동안 트래픽이 있었으면 간격을 두 배로 늘리고, 없었으면 기본 간격으로 되돌립니다.
+func (s *pingSchedule) adapt() {
+	if s.opts.Activity == nil {
+		return
+	}
+	if s.opts.Activity() {
+		s.current = min(s.current*2, s.maxInterval())
+	} else {
+		s.current = s.base  // 유휴 상태에서는 상대의 상태를 빨리 확인하도록 간격을 좁힘
+	}
+}
+
+// wait는 현재 간격에 지터를 적용한 대기 시간을 반환합니다.
+func (s *pingSchedule) wait() time.Duration {
+	return jittered(s.current, s.opts.Jitter, s.rand)
+}
+
+// jittered는 d를 [-jitter, +jitter) 비율만큼 무작위로 흔든 값을 반환합니다. jitter는 0~1로 제한합니다.
+func jittered(d time.Duration, jitter float64, rand func() float64) time.Duration {
+	jitter = min(max(jitter, 0), 1)
+	if jitter == 0 {
+		return d
 	}
+	d = time.Duration(float64(d) * (1 + jitter*(2*rand()-1)))
+	return max(d, time.Millisecond)
 }
@@ -0,0 +1,259 @@
+package ch03
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pingRecorder는 ping이 작성될 때마다 시계의 현재 시각을 채널로 보내는 io.Writer입니다.
+type pingRecorder struct {
+	clock Clock
+	pings chan time.Time
+}
+
+func (r *pingRecorder) Write(p []byte) (int, error) {
+	r.pings <- r.clock.Now()
+	return len(p), nil
+}
+
+// TestPingerWithClock은 Pinger가 간격마다 ping을 보내고 reset 채널로 간격을 바꾸는지
+// 실제로 기다리지 않고 테스트합니다.
+func TestPingerWithClock(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := NewFakeClock(start)
+	w := &pingRecorder{clock: clock, pings: make(chan time.Time, 10)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	reset := make(chan time.Duration) // 버퍼가 없으므로 Pinger가 값을 받을 때까지 블로킹
+	go func() {
+		PingerWithClock(ctx, clock, w, reset)
+		close(done)
+	}()
+
+	// expectPing은 Pinger가 시작 이후 at이 지난 시점에 ping을 보냈는지 확인
+	expectPing := func(at time.Duration) {
+		t.Helper()
+		select {
+		case sent := <-w.pings:
+			if sent.Sub(start) != at {
+				t.Errorf("expected ping at %s; actual %s", at, sent.Sub(start))
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected ping at %s", at)
+		}
+	}
+
+	// reset 채널에 값이 없으면 기본 간격을 사용
+	clock.WaitForTimer(defaultPingInterval)
+	clock.Advance(defaultPingInterval)
+	expectPing(defaultPingInterval)
+
+	// 새 간격은 타이머를 다시 시작해 지금부터 적용
+	clock.WaitForTimer(defaultPingInterval)
+	clock.Advance(10 * time.Second)
+	reset <- time.Second
+	clock.WaitForTimer(time.Second)
+	clock.Advance(time.Second)
+	expectPing(defaultPingInterval + 11*time.Second)
+
+	// 0을 보내면 간격은 유지한 채 타이머만 다시 시작
+	clock.WaitForTimer(time.Second)
+	clock.Advance(500 * time.Millisecond)
+	reset <- 0
+	clock.WaitForTimer(time.Second)
+	clock.Advance(time.Second)
+	expectPing(defaultPingInterval + 12500*time.Millisecond)
+
+	cancel()
+	<-done
+	if len(w.pings) != 0 {
+		t.Errorf("unexpected extra pings: %d", len(w.pings))
+	}
+}
+
+// TestPingScheduleJitter는 지터를 적용한 대기 시간이 간격의 ±Jitter 범위 안에 있는지 테스트합니다.
+func TestPingScheduleJitter(t *testing.T) {
+	tests := []struct {
+		rand float64
+		want time.Duration
+	}{
+		{0, 8 * time.Second},
+		{0.5, 10 * time.Second},
+		{0.75, 11 * time.Second},
+	}
+
+	for _, tc := range tests {
+		s := &pingSchedule{opts: PingOptions{Jitter: 0.2}, rand: func() float64 { return tc.rand }}
+		s.setBase(10 * time.Second)
+		if d := s.wait(); d != tc.want {
+			t.Errorf("rand %v: expected %s; actual %s", tc.rand, tc.want, d)
+		}
+	}
+
+	// 실제 난수로도 항상 범위 안에 있어야 함
+	s := &pingSchedule{opts: PingOptions{Jitter: 0.5}, rand: rand.Float64}
+	s.setBase(time.Second)
+	for i := 0; i < 1000; i++ {
+		if d := s.wait(); d < 500*time.Millisecond || d >= 1500*time.Millisecond {
+			t.Fatalf("wait %s out of range", d)
+		}
+	}
+}
+
+// TestPingerAdaptive는 적응 모드에서 트래픽이 있으면 간격이 MaxInterval까지 늘어나고
+// 유휴 상태가 되면 기본 간격으로 돌아오는지 테스트합니다.
+func TestPingerAdaptive(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := NewFakeClock(start)
+	w := &pingRecorder{clock: clock, pings: make(chan time.Time, 10)}
+
+	var active atomic.Bool
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	reset := make(chan time.Duration, 1)
+	reset <- time.Second
+	go func() {
+		PingerWithOptions(ctx, w, reset, PingOptions{
+			Clock:       clock,
+			Activity:    active.Load,
+			MaxInterval: 3 * time.Second,
+		})
+		close(done)
+	}()
+
+	// expectNext는 현재 예약된 간격이 d인지 확인하고 시간을 흘려 ping을 받음
+	elapsed := time.Duration(0)
+	expectNext := func(d time.Duration) {
+		t.Helper()
+		clock.WaitForTimer(d)
+		clock.Advance(d)
+		elapsed += d
+		select {
+		case sent := <-w.pings:
+			if sent.Sub(start) != elapsed {
+				t.Errorf("expected ping at %s; actual %s", elapsed, sent.Sub(start))
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected ping after %s", d)
+		}
+	}
+
+	active.Store(true)
+	expectNext(time.Second)     // 트래픽이 있었으므로 다음 간격은 2초
+	expectNext(2 * time.Second) // 다음 간격은 MaxInterval인 3초
+	expectNext(3 * time.Second)
+	active.Store(false)
+	expectNext(3 * time.Second) // 유휴 상태였으므로 기본 간격으로 돌아옴
+	expectNext(time.Second)
+
+	cancel()
+	<-done
+}
+
+// failWriter는 항상 err를 반환하는 io.Writer입니다.
+type failWriter struct{ err error }
+
+func (w failWriter) Write([]byte) (int, error) { return 0, w.err }
+
+// TestPingerError는 Pinger가 종료된 원인을 ctx 취소, 메시지 생성 실패, 쓰기 실패로 구분해 반환하는지 테스트합니다.
+func TestPingerError(t *testing.T) {
+	errBroken := errors.New("broken pipe")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// 쓰기가 막히면 쓰기 데드라인으로 종료
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		w      io.Writer
+		opts   PingOptions
+		reason PingStopReason
+		err    error
+	}{
+		{"canceled", ctx, io.Discard, PingOptions{}, PingCanceled, context.Canceled},
+		{"message", context.Background(), io.Discard, PingOptions{
+			Message: func() ([]byte, error) { return nil, errBroken },
+		}, PingMessageFailed, errBroken},
+		{"write", context.Background(), failWriter{errBroken}, PingOptions{}, PingWriteFailed, errBroken},
+		{"deadline", context.Background(), client, PingOptions{WriteTimeout: 20 * time.Millisecond},
+			PingWriteFailed, os.ErrDeadlineExceeded},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reset := make(chan time.Duration, 1)
+			reset <- time.Millisecond
+
+			done := make(chan error, 1)
+			go func() { done <- PingerWithOptions(tc.ctx, tc.w, reset, tc.opts) }()
+
+			var err error
+			select {
+			case err = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("pinger did not stop")
+			}
+			var pingErr *PingError
+			if !errors.As(err, &pingErr) || pingErr.Reason != tc.reason || !errors.Is(err, tc.err) {
+				t.Errorf("expected %s (%v); actual %v", tc.reason, tc.err, err)
+			}
+		})
+	}
+}
+
+// deadlineWriter는 ping을 기록하고 쓰기 데드라인을 설정한 횟수를 세는 io.Writer입니다.
+type deadlineWriter struct {
+	writes    chan struct{}
+	deadlines atomic.Int32
+}
+
+func (w *deadlineWriter) Write(p []byte) (int, error) {
+	select {
+	case w.writes <- struct{}{}:
+	default: // 테스트가 이미 첫 ping을 받았으면 기다리지 않음
+	}
+	return len(p), nil
+}
+
+func (w *deadlineWriter) SetWriteDeadline(time.Time) error {
+	w.deadlines.Add(1)
+	return nil
+}
+
+// TestPingerWriteDeadline은 WriteTimeout을 설정했을 때만 ping마다 쓰기 데드라인을 설정하고 해제하는지 테스트합니다.
+func TestPingerWriteDeadline(t *testing.T) {
+	for _, timeout := range []time.Duration{0, time.Second} {
+		w := &deadlineWriter{writes: make(chan struct{}, 1)}
+		ctx, cancel := context.WithCancel(context.Background())
+		reset := make(chan time.Duration, 1)
+		reset <- time.Millisecond
+
+		done := make(chan error, 1)
+		go func() { done <- PingerWithOptions(ctx, w, reset, PingOptions{WriteTimeout: timeout}) }()
+
+		<-w.writes
+		cancel()
+		<-done
+
+		// 0이면 데드라인을 건드리지 않고, 설정되면 ping마다 설정과 해제를 한 번씩 함
+		got := w.deadlines.Load()
+		if timeout == 0 && got != 0 {
+			t.Errorf("expected no deadline changes without WriteTimeout; actual %d", got)
+		}
+		if timeout > 0 && (got == 0 || got%2 != 0) {
+			t.Errorf("expected paired deadline changes with WriteTimeout; actual %d", got)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package ch03
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 재시도 기본값 정의
+const (
+	defaultMaxAttempts = 5                      // 기본 최대 연결 시도 횟수
+	defaultBaseDelay   = 100 * time.Millisecond // 첫 재시도 전에 기다리는 기본 시간
+	defaultMaxDelay    = 10 * time.Second       // 재시도 사이에 기다리는 기본 최대 시간
+)
+
+// DialErrorKind는 연결 실패의 종류입니다.
+type DialErrorKind uint8
+
+// 연결 실패 종류 정의
+const (
+	DialErrOther    DialErrorKind = iota // 0 (그 밖의 에러)
+	DialErrTimeout                       // 1 (연결 시간 초과)
+	DialErrRefused                       // 2 (상대가 연결을 거부함)
+	DialErrDNS                           // 3 (이름 해석 실패)
+	DialErrCanceled                      // 4 (호출자의 ctx가 취소되었거나 만료됨)
+)
+
+func (k DialErrorKind) String() string {
+	switch k {
+	case DialErrTimeout:
+		return "timeout"
+	case DialErrRefused:
+		return "refused"
+	case DialErrDNS:
+		return "dns"
+	case DialErrCanceled:
+		return "canceled"
+	}
+	return "other"
+}
+
+// ClassifyDialError는 연결 에러의 종류를 판단합니다.
+// Dialer.Timeout과 Dialer.Deadline에 의한 시간 초과도 context.DeadlineExceeded와 일치하므로,
+// 에러만으로는 호출자의 ctx가 만료된 것과 구별할 수 없어 시간 초과로 분류합니다.
+// 호출자의 ctx가 끝났는지는 ctx.Err()로 따로 확인해야 합니다.
+func ClassifyDialError(err error) DialErrorKind {
+	var (
+		dnsErr *net.DNSError
+		nErr   net.Error
+	)
+	switch {
+	case errors.As(err, &nErr) && nErr.Timeout():
+		return DialErrTimeout
+	case errors.Is(err, context.Canceled):
+		return DialErrCanceled
+	case errors.As(err, &dnsErr):
+		return DialErrDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return DialErrRefused
+	}
+	return DialErrOther
+}
+
+// retryable은 다시 시도하면 성공할 수 있는 에러인지 확인합니다.
+// 시간 초과와 일시적인 이름 해석 실패만 재시도하고, 연결 거부나 존재하지 않는 이름은 영구적인 실패로 봅니다.
+func retryable(err error) bool {
+	switch ClassifyDialError(err) {
+	case DialErrTimeout:
+		return true
+	case DialErrDNS:
+		var dnsErr *net.DNSError
+		errors.As(err, &dnsErr)
+		return !dnsErr.IsNotFound && (dnsErr.IsTimeout || dnsErr.IsTemporary)
+	}
+	return false
+}
+
+// DialAttempt는 연결 시도 하나의 결과입니다.
+type DialAttempt struct {
+	Err  error
+	Kind DialErrorKind
+}
+
+// RetryError는 RetryDialer가 연결에 실패했을 때 반환하며, 각 시도의 에러를 순서대로 담고 있습니다.
+type RetryError struct {
+	Network, Address string
+	Attempts         []DialAttempt
+	Err              error // ctx가 취소되거나 만료되어 멈췄으면 ctx.Err()
+}
+
+func (e *RetryError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "dial %s %s: %d attempts failed", e.Network, e.Address, len(e.Attempts))
+	for i, a := range e.Attempts {
+		fmt.Fprintf(&b, "; attempt %d (%s): %v", i+1, a.Kind, a.Err)
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&b, "; %v", e.Err)
+	}
+	return b.String()
+}
+
+// Unwrap은 각 시도의 에러와 취소 원인을 반환하므로 errors.Is와 errors.As로 확인할 수 있습니다.
+func (e *RetryError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Attempts)+1)
+	for _, a := range e.Attempts {
+		errs = append(errs, a.Err)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// RetryDialer는 시간 초과와 일시적인 에러로 연결에 실패하면 지수적으로 늘어나는 간격을 두고 다시 연결하는 Dialer입니다.
+// 영구적인 에러(연결 거부, 존재하지 않는 이름 등)를 받거나, MaxAttempts번 시도했거나, ctx가 취소되면 멈춥니다.
+type RetryDialer struct {
+	Dialer      *net.Dialer   // 각 시도에 사용할 Dialer (nil이면 기본 Dialer, Timeout은 시도마다 적용)
+	MaxAttempts int           // 최대 시도 횟수 (0이면 defaultMaxAttempts)
+	BaseDelay   time.Duration // 첫 재시도 전에 기다리는 시간, 재시도마다 두 배로 늘어남 (0이면 defaultBaseDelay)
+	MaxDelay    time.Duration // 재시도 사이에 기다리는 최대 시간 (0이면 defaultMaxDelay)
+	Jitter      float64       // 기다리는 시간을 무작위로 흔드는 비율 (0~1)
+	Clock       Clock         // 재시도 대기에 사용할 시계 (nil이면 RealClock)
+}
+
+// Dial은 context.Background()로 DialContext를 호출합니다.
+func (r *RetryDialer) Dial(network, address string) (net.Conn, error) {
+	return r.DialContext(context.Background(), network, address)
+}
+
+// DialContext는 연결에 성공할 때까지 재시도합니다. 실패하면 각 시도의 에러를 담은 *RetryError를 반환합니다.
+func (r *RetryDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d := r.Dialer
+	if d == nil {
+		d = new(net.Dialer)
+	}
+	clock := r.Clock
+	if clock == nil {
+		clock = RealClock
+	}
+	maxAttempts := r.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	rErr := &RetryError{Network: network, Address: address}
+	for attempt := 1; ; attempt++ {
+		conn, err := d.DialContext(ctx, network, address)
+		if err == nil {
+			return conn, nil
+		}
+		kind := ClassifyDialError(err)
+		if ctx.Err() != nil {
+			// 시도별 시간 초과가 아니라 호출자의 ctx 때문에 실패한 시도
+			kind = DialErrCanceled
+			rErr.Err = ctx.Err()
+		}
+		rErr.Attempts = append(rErr.Attempts, DialAttempt{Err: err, Kind: kind})
+		if rErr.Err != nil || attempt >= maxAttempts || !retryable(err) {
+			return nil, rErr
+		}
+
+		timer := clock.NewTimer(r.delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			rErr.Err = ctx.Err()
+			return nil, rErr
+		case <-timer.C():
+		}
+	}
+}
+
+// delay는 attempt번째 시도가 실패한 뒤 기다릴 시간을 반환합니다.
+func (r *RetryDialer) delay(attempt int) time.Duration {
+	base, maxDelay := r.BaseDelay, r.MaxDelay
+	if base <= 0 {
+		base = defaultBaseDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxDelay
+	}
+
+	d := base
+	for i := 1; i < attempt && d < maxDelay; i++ {
+		d *= 2
+	}
+	return jittered(min(d, maxDelay), r.Jitter, rand.Float64)
+}
@@ -0,0 +1,194 @@
+package ch03
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// timeoutControl은 처음 fail번의 연결 시도를 타임아웃 에러로 실패시키는 Control 함수를 반환합니다.
+func timeoutControl(fail int) func(string, string, syscall.RawConn) error {
+	attempts := 0
+	return func(_, _ string, _ syscall.RawConn) error {
+		if attempts++; attempts <= fail {
+			return timeoutError{}
+		}
+		return nil
+	}
+}
+
+// TestRetryDialer는 타임아웃 에러를 지수적으로 늘어나는 간격으로 재시도하는지 테스트합니다.
+func TestRetryDialer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	advance := func(delays ...time.Duration) {
+		for _, d := range delays {
+			clock.WaitForTimer(d)
+			clock.Advance(d)
+		}
+	}
+
+	t.Run("success", func(t *testing.T) {
+		r := &RetryDialer{
+			Dialer:    &net.Dialer{Control: timeoutControl(2)},
+			BaseDelay: time.Second,
+			Clock:     clock,
+		}
+		go advance(time.Second, 2*time.Second)
+
+		conn, err := r.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.Close()
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		r := &RetryDialer{
+			Dialer:      &net.Dialer{Control: timeoutControl(10)},
+			MaxAttempts: 4,
+			BaseDelay:   time.Second,
+			MaxDelay:    3 * time.Second,
+			Clock:       clock,
+		}
+		go advance(time.Second, 2*time.Second, 3*time.Second) // MaxDelay에서 멈춤
+
+		_, err := r.Dial("tcp", listener.Addr().String())
+		var rErr *RetryError
+		if !errors.As(err, &rErr) || len(rErr.Attempts) != 4 {
+			t.Fatalf("expected 4 attempts; actual %v", err)
+		}
+		for _, a := range rErr.Attempts {
+			if a.Kind != DialErrTimeout {
+				t.Errorf("expected timeout; actual %s", a.Kind)
+			}
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		r := &RetryDialer{
+			Dialer:    &net.Dialer{Control: timeoutControl(10)},
+			BaseDelay: time.Second,
+			Clock:     clock,
+		}
+		go func() {
+			clock.WaitForTimer(time.Second) // 첫 재시도를 기다리는 중에 취소
+			cancel()
+		}()
+
+		_, err := r.DialContext(ctx, "tcp", listener.Addr().String())
+		var rErr *RetryError
+		if !errors.Is(err, context.Canceled) || !errors.As(err, &rErr) || len(rErr.Attempts) != 1 {
+			t.Errorf("expected cancellation after 1 attempt; actual %v", err)
+		}
+	})
+}
+
+// TestRetryDialerDeadline은 Dialer.Timeout에 의한 시도별 시간 초과는 재시도하고,
+// 호출자의 ctx가 만료되면 취소로 기록하고 멈추는지 테스트합니다.
+func TestRetryDialerDeadline(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	t.Run("dialer timeout", func(t *testing.T) {
+		clock := NewFakeClock(time.Unix(0, 0))
+		r := &RetryDialer{
+			Dialer:      &net.Dialer{Timeout: time.Nanosecond}, // 모든 시도가 시간 초과
+			MaxAttempts: 2,
+			BaseDelay:   time.Second,
+			Clock:       clock,
+		}
+		go func() {
+			clock.WaitForTimer(time.Second)
+			clock.Advance(time.Second)
+		}()
+
+		_, err := r.Dial("tcp", listener.Addr().String())
+		var rErr *RetryError
+		if !errors.As(err, &rErr) || len(rErr.Attempts) != 2 {
+			t.Fatalf("expected 2 attempts; actual %v", err)
+		}
+		for _, a := range rErr.Attempts {
+			if a.Kind != DialErrTimeout {
+				t.Errorf("expected timeout; actual %s", a.Kind)
+			}
+		}
+		if rErr.Err != nil {
+			t.Errorf("expected no context error; actual %v", rErr.Err)
+		}
+	})
+
+	t.Run("context deadline", func(t *testing.T) {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		r := &RetryDialer{BaseDelay: time.Hour} // 재시도하면 테스트가 끝나지 않음
+
+		_, err := r.DialContext(ctx, "tcp", listener.Addr().String())
+		var rErr *RetryError
+		if !errors.As(err, &rErr) || len(rErr.Attempts) != 1 || rErr.Attempts[0].Kind != DialErrCanceled {
+			t.Fatalf("expected 1 canceled attempt; actual %v", err)
+		}
+		if rErr.Err != context.DeadlineExceeded {
+			t.Errorf("expected %v; actual %v", context.DeadlineExceeded, rErr.Err)
+		}
+	})
+}
+
+// TestRetryDialerPermanent는 연결 거부와 같은 영구적인 에러는 재시도하지 않는지 테스트합니다.
+func TestRetryDialerPermanent(t *testing.T) {
+	// 리스너를 닫아 연결을 거부하는 주소를 얻음
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	r := &RetryDialer{BaseDelay: time.Hour} // 재시도하면 테스트가 끝나지 않음
+	_, err = r.Dial("tcp", addr)
+	var rErr *RetryError
+	if !errors.As(err, &rErr) || len(rErr.Attempts) != 1 || rErr.Attempts[0].Kind != DialErrRefused {
+		t.Fatalf("expected 1 refused attempt; actual %v", err)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("expected ECONNREFUSED; actual %v", err)
+	}
+}
+
+// TestClassifyDialError는 연결 에러의 종류와 재시도 여부를 판단하는지 테스트합니다.
+func TestClassifyDialError(t *testing.T) {
+	tests := []struct {
+		err       error
+		kind      DialErrorKind
+		retryable bool
+	}{
+		{&net.OpError{Op: "dial", Err: timeoutError{}}, DialErrTimeout, true},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, DialErrRefused, false},
+		{&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}, DialErrDNS, false},
+		{&net.OpError{Op: "dial", Err: &net.DNSError{Err: "server misbehaving", IsTemporary: true}}, DialErrDNS, true},
+		{&net.OpError{Op: "dial", Err: context.Canceled}, DialErrCanceled, false},
+		{&net.OpError{Op: "dial", Err: context.DeadlineExceeded}, DialErrTimeout, true}, // 에러만으로는 시도별 시간 초과와 구별할 수 없음
+		{errors.New("unknown"), DialErrOther, false},
+	}
+
+	for _, tc := range tests {
+		if kind := ClassifyDialError(tc.err); kind != tc.kind {
+			t.Errorf("%v: expected %s; actual %s", tc.err, tc.kind, kind)
+		}
+		if r := retryable(tc.err); r != tc.retryable {
+			t.Errorf("%v: expected retryable %t; actual %t", tc.err, tc.retryable, r)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package ch03
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const defaultRTTWindow = 16 // RTT 통계에 사용할 기본 표본 수
+
+// RTTStats는 최근 ping 왕복 시간의 통계입니다. ping 명령의 요약과 같은 값을 제공합니다.
+type RTTStats struct {
+	Count  int           // 통계에 사용한 표본 수 (최대 RTTWindow)
+	Last   time.Duration // 가장 최근의 왕복 시간
+	Min    time.Duration
+	Avg    time.Duration
+	Max    time.Duration
+	Jitter time.Duration // 왕복 시간의 표준 편차 (ping의 mdev)
+}
+
+// rttWindow는 최근 size개의 왕복 시간을 보관하는 링 버퍼입니다.
+type rttWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int // 다음 표본을 쓸 위치
+	full    bool
+	last    time.Duration
+}
+
+// newRTTWindow는 size개의 표본을 보관하는 rttWindow를 생성합니다.
+func newRTTWindow(size int) *rttWindow {
+	if size <= 0 {
+		size = defaultRTTWindow
+	}
+	return &rttWindow{samples: make([]time.Duration, size)}
+}
+
+// add는 왕복 시간 표본을 추가합니다. 창이 가득 차면 가장 오래된 표본을 덮어씁니다.
+func (w *rttWindow) add(rtt time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.samples[w.next] = rtt
+	w.last = rtt
+	if w.next++; w.next == len(w.samples) {
+		w.next, w.full = 0, true
+	}
+}
+
+// stats는 창에 있는 표본으로 통계를 계산합니다.
+func (w *rttWindow) stats() RTTStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	samples := w.samples[:w.next]
+	if w.full {
+		samples = w.samples
+	}
+	if len(samples) == 0 {
+		return RTTStats{}
+	}
+
+	s := RTTStats{Count: len(samples), Last: w.last, Min: samples[0], Max: samples[0]}
+	var sum float64
+	for _, rtt := range samples {
+		s.Min = min(s.Min, rtt)
+		s.Max = max(s.Max, rtt)
+		sum += float64(rtt)
+	}
+	avg := sum / float64(len(samples))
+
+	var variance float64
+	for _, rtt := range samples {
+		d := float64(rtt) - avg
+		variance += d * d
+	}
+	s.Avg = time.Duration(avg)
+	s.Jitter = time.Duration(math.Sqrt(variance / float64(len(samples))))
+
+	return s
+}
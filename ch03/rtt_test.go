@@ -0,0 +1,32 @@
+package ch03
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRTTWindow는 최근 표본만으로 최소, 평균, 최대, 지터를 계산하는지 테스트합니다.
+func TestRTTWindow(t *testing.T) {
+	w := newRTTWindow(4)
+	if s := w.stats(); s.Count != 0 {
+		t.Fatalf("expected empty stats; actual %+v", s)
+	}
+
+	// 창의 크기보다 많이 추가하면 가장 오래된 표본(100ms)이 밀려남
+	for _, ms := range []int{100, 10, 20, 30, 40} {
+		w.add(time.Duration(ms) * time.Millisecond)
+	}
+
+	s := w.stats()
+	expected := RTTStats{
+		Count:  4,
+		Last:   40 * time.Millisecond,
+		Min:    10 * time.Millisecond,
+		Avg:    25 * time.Millisecond,
+		Max:    40 * time.Millisecond,
+		Jitter: 11180339, // sqrt(125) ms
+	}
+	if s != expected {
+		t.Errorf("expected %+v; actual %+v", expected, s)
+	}
+}
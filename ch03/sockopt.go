@@ -0,0 +1,127 @@
+package ch03
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 소켓 옵션 관련 에러 정의
+var (
+	ErrSockoptUnsupported = errors.New("socket option not supported on this platform") // 현재 플랫폼에서 설정할 수 없는 옵션
+	ErrNotTCPConn         = errors.New("not a TCP connection")                         // Apply에 net.TCPConn이 아닌 연결을 전달함
+)
+
+// SocketOptions는 TCP 연결에 적용할 커널 소켓 옵션입니다. 0인 필드는 운영체제 기본값을 유지합니다.
+//
+// Control을 net.Dialer나 net.ListenConfig의 Control로 사용하면 연결하기 전(또는 수신 소켓에) 옵션을 설정하며,
+// 리스너에 설정한 옵션은 수락한 연결이 물려받습니다. Go는 연결이 만들어진 뒤 TCP_NODELAY를 켜고
+// KeepAlive 필드에 따라 keepalive 간격을 다시 설정하므로, Dialer와 ListenConfig 메서드로 이를 막거나
+// 연결된 뒤 Apply를 호출해야 합니다. TCP가 아닌 소켓(UDP, Unix 소켓 등)에는 버퍼 크기만 설정합니다.
+type SocketOptions struct {
+	// KeepAlive는 TCP keepalive(SO_KEEPALIVE)를 켭니다. 아래 keepalive 값 중 하나라도 설정되면 함께 켬
+	KeepAlive         bool
+	KeepAliveIdle     time.Duration // 첫 keepalive 프로브를 보내기까지의 유휴 시간 (TCP_KEEPIDLE, 초 단위)
+	KeepAliveInterval time.Duration // 응답이 없을 때 프로브를 다시 보내는 간격 (TCP_KEEPINTVL, 초 단위)
+	KeepAliveCount    int           // 연결을 끊기까지 응답 없이 보낼 프로브 수 (TCP_KEEPCNT)
+
+	// UserTimeout은 보낸 데이터가 확인 응답 없이 남아 있을 수 있는 최대 시간입니다 (TCP_USER_TIMEOUT, 밀리초 단위)
+	UserTimeout time.Duration
+
+	// Nagle은 Nagle 알고리즘을 켭니다 (TCP_NODELAY 끔). Go는 연결마다 Nagle 알고리즘을 끄므로 Apply에서만 적용됨
+	Nagle bool
+
+	// Linger는 Close할 때 보내지 못한 데이터를 기다리는 시간입니다 (SO_LINGER, 초 단위)
+	// 0이면 운영체제 기본값을 유지하고, 음수이면 기다리지 않고 RST로 연결을 끊음
+	Linger time.Duration
+
+	ReadBuffer  int // 수신 버퍼 크기 (SO_RCVBUF, 바이트)
+	WriteBuffer int // 송신 버퍼 크기 (SO_SNDBUF, 바이트)
+}
+
+// keepAlive는 keepalive를 켜야 하는지 확인합니다.
+func (o *SocketOptions) keepAlive() bool {
+	return o.KeepAlive || o.KeepAliveIdle > 0 || o.KeepAliveInterval > 0 || o.KeepAliveCount > 0
+}
+
+// linuxOnly는 Linux에서만 설정할 수 있는 TCP 옵션이 하나라도 설정되어 있는지 확인합니다.
+func (o *SocketOptions) linuxOnly() bool {
+	return o.KeepAliveIdle > 0 || o.KeepAliveInterval > 0 || o.KeepAliveCount > 0 || o.UserTimeout > 0
+}
+
+// Control은 net.Dialer.Control이나 net.ListenConfig.Control로 사용할 수 있는 함수로, 소켓에 옵션을 설정합니다.
+// network가 TCP가 아니면 TCP 연결에만 의미가 있는 옵션은 건너뜁니다.
+func (o *SocketOptions) Control(network, _ string, c syscall.RawConn) error {
+	tcp := strings.HasPrefix(network, "tcp")
+	var err error
+	if cErr := c.Control(func(fd uintptr) { err = o.set(fd, tcp) }); cErr != nil {
+		return cErr
+	}
+	return err
+}
+
+// Dialer는 d를 복사해 연결하기 전에 옵션을 설정하는 net.Dialer를 반환합니다. d가 nil이면 기본 Dialer를 사용합니다.
+// d에 Control 함수가 있으면 옵션을 설정한 뒤 호출하며, keepalive 옵션이 있으면 Go가 덮어쓰지 않도록
+// KeepAlive를 음수로 설정합니다.
+func (o *SocketOptions) Dialer(d *net.Dialer) *net.Dialer {
+	dialer := new(net.Dialer)
+	if d != nil {
+		*dialer = *d
+	}
+	dialer.Control = o.chain(dialer.Control)
+	if o.keepAlive() {
+		dialer.KeepAlive = -1
+	}
+	return dialer
+}
+
+// ListenConfig는 lc를 복사해 수신 소켓에 옵션을 설정하는 net.ListenConfig를 반환합니다. lc가 nil이면 기본값을 사용합니다.
+// 수락한 연결은 수신 소켓의 옵션을 물려받습니다.
+func (o *SocketOptions) ListenConfig(lc *net.ListenConfig) *net.ListenConfig {
+	config := new(net.ListenConfig)
+	if lc != nil {
+		*config = *lc
+	}
+	config.Control = o.chain(config.Control)
+	if o.keepAlive() {
+		config.KeepAlive = -1
+	}
+	return config
+}
+
+// chain은 옵션을 설정한 뒤 control을 호출하는 Control 함수를 반환합니다.
+func (o *SocketOptions) chain(control func(string, string, syscall.RawConn) error) func(string, string, syscall.RawConn) error {
+	if control == nil {
+		return o.Control
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		if err := o.Control(network, address, c); err != nil {
+			return err
+		}
+		return control(network, address, c)
+	}
+}
+
+// Apply는 이미 연결된 conn에 옵션을 설정합니다. Nagle을 포함한 모든 옵션을 적용하므로,
+// 직접 수락하거나 연결한 net.TCPConn의 옵션을 바꿀 때 사용합니다.
+func (o *SocketOptions) Apply(conn net.Conn) error {
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return ErrNotTCPConn
+	}
+	if err := tcp.SetNoDelay(!o.Nagle); err != nil {
+		return err
+	}
+	raw, err := tcp.SyscallConn()
+	if err != nil {
+		return err
+	}
+	return o.Control("tcp", conn.RemoteAddr().String(), raw)
+}
+
+// seconds는 d를 1초 이상의 정수 초로 올림합니다.
+func seconds(d time.Duration) int {
+	return max(int((d+time.Second-1)/time.Second), 1)
+}
@@ -0,0 +1,41 @@
+//go:build linux
+
+package ch03
+
+import (
+	"os"
+	"syscall"
+)
+
+// tcpUserTimeout은 syscall 패키지에 정의되지 않은 TCP_USER_TIMEOUT 옵션 번호입니다.
+const tcpUserTimeout = 0x12
+
+// set은 소켓 fd에 옵션을 설정합니다. tcp가 false이면 TCP 수준 옵션은 건너뜁니다.
+func (o *SocketOptions) set(fd uintptr, tcp bool) error {
+	s := int(fd)
+
+	if tcp {
+		type option struct {
+			name    string
+			opt     int
+			value   int
+			enabled bool
+		}
+		options := []option{
+			{"TCP_KEEPIDLE", syscall.TCP_KEEPIDLE, seconds(o.KeepAliveIdle), o.KeepAliveIdle > 0},
+			{"TCP_KEEPINTVL", syscall.TCP_KEEPINTVL, seconds(o.KeepAliveInterval), o.KeepAliveInterval > 0},
+			{"TCP_KEEPCNT", syscall.TCP_KEEPCNT, o.KeepAliveCount, o.KeepAliveCount > 0},
+			{"TCP_USER_TIMEOUT", tcpUserTimeout, int(o.UserTimeout.Milliseconds()), o.UserTimeout > 0},
+		}
+		for _, opt := range options {
+			if !opt.enabled {
+				continue
+			}
+			if err := syscall.SetsockoptInt(s, syscall.IPPROTO_TCP, opt.opt, opt.value); err != nil {
+				return os.NewSyscallError("setsockopt "+opt.name, err)
+			}
+		}
+	}
+
+	return o.setSocket(s, tcp)
+}
@@ -0,0 +1,152 @@
+//go:build linux
+
+package ch03
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// getsockopt는 연결의 정수 소켓 옵션 값을 읽습니다.
+func getsockopt(t *testing.T, conn net.Conn, level, opt int) int {
+	t.Helper()
+
+	raw, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value int
+	if cErr := raw.Control(func(fd uintptr) {
+		value, err = syscall.GetsockoptInt(int(fd), level, opt)
+	}); cErr != nil {
+		t.Fatal(cErr)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+// TestSocketOptions는 Dialer와 ListenConfig로 설정한 옵션이 연결한 소켓과 수락한 소켓에 적용되는지 테스트합니다.
+func TestSocketOptions(t *testing.T) {
+	opts := &SocketOptions{
+		KeepAliveIdle:     30 * time.Second,
+		KeepAliveInterval: 5 * time.Second,
+		KeepAliveCount:    4,
+		UserTimeout:       10 * time.Second,
+		Linger:            -1,
+		ReadBuffer:        64 << 10,
+	}
+
+	listener, err := opts.ListenConfig(nil).Listen(context.Background(), "tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// 기존 Control 함수도 옵션을 설정한 뒤 호출되어야 함
+	called := false
+	d := opts.Dialer(&net.Dialer{Control: func(_, _ string, _ syscall.RawConn) error {
+		called = true
+		return nil
+	}})
+	client, err := d.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if !called {
+		t.Error("expected existing Control to be called")
+	}
+
+	server, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		level, opt int
+		want       int
+	}{
+		{"SO_KEEPALIVE", syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, 1},
+		{"TCP_KEEPIDLE", syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, 30},
+		{"TCP_KEEPINTVL", syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, 5},
+		{"TCP_KEEPCNT", syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, 4},
+		{"TCP_USER_TIMEOUT", syscall.IPPROTO_TCP, tcpUserTimeout, 10000},
+	}
+	for _, conn := range []net.Conn{client, server} {
+		for _, tc := range tests {
+			if got := getsockopt(t, conn, tc.level, tc.opt); got != tc.want {
+				t.Errorf("%s: expected %d; actual %d", tc.name, tc.want, got)
+			}
+		}
+		// 커널은 관리 공간을 위해 요청한 크기의 두 배를 설정함
+		if got := getsockopt(t, conn, syscall.SOL_SOCKET, syscall.SO_RCVBUF); got < opts.ReadBuffer {
+			t.Errorf("SO_RCVBUF: expected at least %d; actual %d", opts.ReadBuffer, got)
+		}
+	}
+
+	// Nagle은 연결된 뒤 Apply로만 적용
+	if got := getsockopt(t, client, syscall.IPPROTO_TCP, syscall.TCP_NODELAY); got != 1 {
+		t.Errorf("TCP_NODELAY: expected 1; actual %d", got)
+	}
+	if err := (&SocketOptions{Nagle: true}).Apply(client); err != nil {
+		t.Fatal(err)
+	}
+	if got := getsockopt(t, client, syscall.IPPROTO_TCP, syscall.TCP_NODELAY); got != 0 {
+		t.Errorf("TCP_NODELAY: expected 0; actual %d", got)
+	}
+
+	pipe, _ := net.Pipe()
+	defer pipe.Close()
+	if err := opts.Apply(pipe); !errors.Is(err, ErrNotTCPConn) {
+		t.Errorf("expected ErrNotTCPConn; actual %v", err)
+	}
+}
+
+// TestSocketOptionsUDP는 UDP 소켓에는 TCP 옵션을 건너뛰고 버퍼 크기만 설정하는지 테스트합니다.
+func TestSocketOptionsUDP(t *testing.T) {
+	opts := &SocketOptions{
+		KeepAliveIdle: 30 * time.Second,
+		UserTimeout:   10 * time.Second,
+		Linger:        -1,
+		ReadBuffer:    64 << 10,
+	}
+
+	conn, err := opts.ListenConfig(nil).ListenPacket(context.Background(), "udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client, err := opts.Dialer(nil).Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	for _, c := range []syscall.Conn{conn.(*net.UDPConn), client.(*net.UDPConn)} {
+		raw, err := c.SyscallConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got int
+		if cErr := raw.Control(func(fd uintptr) {
+			got, err = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+		}); cErr != nil {
+			t.Fatal(cErr)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got < opts.ReadBuffer {
+			t.Errorf("SO_RCVBUF: expected at least %d; actual %d", opts.ReadBuffer, got)
+		}
+	}
+}
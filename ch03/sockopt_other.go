@@ -0,0 +1,12 @@
+//go:build unix && !linux
+
+package ch03
+
+// set은 소켓 fd에 옵션을 설정합니다. keepalive 세부 값과 UserTimeout은 Linux에서만 설정할 수 있으므로
+// TCP 소켓에 이 값이 설정되어 있으면 ErrSockoptUnsupported를 반환합니다.
+func (o *SocketOptions) set(fd uintptr, tcp bool) error {
+	if tcp && o.linuxOnly() {
+		return ErrSockoptUnsupported
+	}
+	return o.setSocket(int(fd), tcp)
+}
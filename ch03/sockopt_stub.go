@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package ch03
+
+// set은 소켓 옵션을 설정할 수 없는 플랫폼에서 옵션이 하나라도 설정되어 있으면 ErrSockoptUnsupported를 반환합니다.
+// Nagle은 Apply가 net.TCPConn으로 설정하므로 제외합니다.
+func (o *SocketOptions) set(_ uintptr, tcp bool) error {
+	if o.ReadBuffer > 0 || o.WriteBuffer > 0 {
+		return ErrSockoptUnsupported
+	}
+	if tcp && (o.keepAlive() || o.UserTimeout > 0 || o.Linger != 0) {
+		return ErrSockoptUnsupported
+	}
+	return nil
+}
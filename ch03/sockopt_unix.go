@@ -0,0 +1,43 @@
+//go:build unix
+
+package ch03
+
+import (
+	"os"
+	"syscall"
+)
+
+// setSocket은 유닉스 계열 운영체제에서 공통으로 지원하는 소켓 수준(SOL_SOCKET) 옵션을 설정합니다.
+// tcp가 false이면 keepalive와 linger는 건너뛰고 버퍼 크기만 설정합니다.
+func (o *SocketOptions) setSocket(s int, tcp bool) error {
+	type option struct {
+		name    string
+		opt     int
+		value   int
+		enabled bool
+	}
+	options := []option{
+		{"SO_KEEPALIVE", syscall.SO_KEEPALIVE, 1, tcp && o.keepAlive()},
+		{"SO_RCVBUF", syscall.SO_RCVBUF, o.ReadBuffer, o.ReadBuffer > 0},
+		{"SO_SNDBUF", syscall.SO_SNDBUF, o.WriteBuffer, o.WriteBuffer > 0},
+	}
+	for _, opt := range options {
+		if !opt.enabled {
+			continue
+		}
+		if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, opt.opt, opt.value); err != nil {
+			return os.NewSyscallError("setsockopt "+opt.name, err)
+		}
+	}
+
+	if tcp && o.Linger != 0 {
+		l := &syscall.Linger{Onoff: 1}
+		if o.Linger > 0 {
+			l.Linger = int32(seconds(o.Linger))
+		}
+		if err := syscall.SetsockoptLinger(s, syscall.SOL_SOCKET, syscall.SO_LINGER, l); err != nil {
+			return os.NewSyscallError("setsockopt SO_LINGER", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+//go:build windows
+
+package ch03
+
+import (
+	"os"
+	"syscall"
+)
+
+// set은 소켓 fd에 옵션을 설정합니다. keepalive 세부 값과 UserTimeout은 Linux에서만 설정할 수 있으므로
+// TCP 소켓에 이 값이 설정되어 있으면 ErrSockoptUnsupported를 반환합니다.
+// tcp가 false이면 keepalive와 linger는 건너뛰고 버퍼 크기만 설정합니다.
+func (o *SocketOptions) set(fd uintptr, tcp bool) error {
+	if tcp && o.linuxOnly() {
+		return ErrSockoptUnsupported
+	}
+	s := syscall.Handle(fd)
+
+	type option struct {
+		name    string
+		opt     int
+		value   int
+		enabled bool
+	}
+	options := []option{
+		{"SO_KEEPALIVE", syscall.SO_KEEPALIVE, 1, tcp && o.keepAlive()},
+		{"SO_RCVBUF", syscall.SO_RCVBUF, o.ReadBuffer, o.ReadBuffer > 0},
+		{"SO_SNDBUF", syscall.SO_SNDBUF, o.WriteBuffer, o.WriteBuffer > 0},
+	}
+	for _, opt := range options {
+		if !opt.enabled {
+			continue
+		}
+		if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, opt.opt, opt.value); err != nil {
+			return os.NewSyscallError("setsockopt "+opt.name, err)
+		}
+	}
+
+	if tcp && o.Linger != 0 {
+		l := &syscall.Linger{Onoff: 1}
+		if o.Linger > 0 {
+			l.Linger = int32(seconds(o.Linger))
+		}
+		if err := syscall.SetsockoptLinger(s, syscall.SOL_SOCKET, syscall.SO_LINGER, l); err != nil {
+			return os.NewSyscallError("setsockopt SO_LINGER", err)
+		}
+	}
+	return nil
+}
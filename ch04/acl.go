@@ -0,0 +1,203 @@
+package ch04
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 접근 제어 관련 에러 정의
+var (
+	ErrClientNotAllowed = errors.New("client address not allowed") // ClientACL이 거부한 클라이언트
+	ErrAuthFailed       = errors.New("authentication failed")      // 공유 비밀이 일치하지 않음
+	ErrInvalidACLRule   = errors.New("invalid ACL rule")           // 해석할 수 없는 ACL 규칙
+)
+
+const (
+	defaultAuthTimeout = 10 * time.Second // 인증 프레임을 기다리는 기본 시간
+	maxAuthFrameSize   = 1024             // 인증 프레임 페이로드의 최대 크기
+)
+
+// ACLAction은 ACL 규칙과 일치한 주소를 허용할지 거부할지 나타냅니다.
+type ACLAction uint8
+
+// ACL 동작 정의
+const (
+	ACLAllow ACLAction = iota + 1 // 1 (허용)
+	ACLDeny                       // 2 (거부)
+)
+
+// ACLRule은 주소 대역 하나에 대한 허용 또는 거부 규칙입니다.
+type ACLRule struct {
+	Action ACLAction
+	Prefix netip.Prefix
+}
+
+// ParseACLRule은 "allow 10.0.0.0/8"이나 "deny 192.168.1.5"와 같은 규칙을 해석합니다.
+// 대역 없이 주소만 적으면 그 주소 하나와 일치하는 규칙이 됩니다.
+func ParseACLRule(rule string) (ACLRule, error) {
+	fields := strings.Fields(rule)
+	if len(fields) != 2 {
+		return ACLRule{}, fmt.Errorf("%w: %q", ErrInvalidACLRule, rule)
+	}
+
+	var r ACLRule
+	switch strings.ToLower(fields[0]) {
+	case "allow":
+		r.Action = ACLAllow
+	case "deny":
+		r.Action = ACLDeny
+	default:
+		return ACLRule{}, fmt.Errorf("%w: %q", ErrInvalidACLRule, rule)
+	}
+
+	var err error
+	if strings.Contains(fields[1], "/") {
+		r.Prefix, err = netip.ParsePrefix(fields[1])
+	} else {
+		var addr netip.Addr
+		if addr, err = netip.ParseAddr(fields[1]); err == nil {
+			r.Prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+	}
+	if err != nil {
+		return ACLRule{}, fmt.Errorf("%w: %q", ErrInvalidACLRule, rule)
+	}
+	r.Prefix = r.Prefix.Masked()
+
+	return r, nil
+}
+
+// String 메서드는 규칙을 ParseACLRule이 해석할 수 있는 형태로 반환합니다.
+func (r ACLRule) String() string {
+	action := "allow"
+	if r.Action == ACLDeny {
+		action = "deny"
+	}
+	return action + " " + r.Prefix.String()
+}
+
+// ACL은 주소 대역 규칙 목록입니다. 규칙은 순서대로 검사하며 처음 일치한 규칙을 적용합니다.
+type ACL struct {
+	Rules       []ACLRule
+	DefaultDeny bool // 일치하는 규칙이 없을 때 거부할지 여부 (false이면 허용)
+}
+
+// ParseACL은 문자열 규칙 목록으로 ACL을 생성합니다.
+func ParseACL(defaultDeny bool, rules ...string) (*ACL, error) {
+	acl := &ACL{DefaultDeny: defaultDeny}
+	for _, rule := range rules {
+		r, err := ParseACLRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		acl.Rules = append(acl.Rules, r)
+	}
+	return acl, nil
+}
+
+// Check는 addr을 허용하는지와 판단에 사용한 규칙을 반환합니다.
+// 일치한 규칙이 없으면 "default allow" 또는 "default deny"를 반환합니다.
+func (a *ACL) Check(addr netip.Addr) (allowed bool, rule string) {
+	addr = addr.Unmap() // IPv4-mapped IPv6 주소도 IPv4 규칙과 비교
+	for _, r := range a.Rules {
+		if r.Prefix.Contains(addr) {
+			return r.Action == ACLAllow, r.String()
+		}
+	}
+	if a.DefaultDeny {
+		return false, "default deny"
+	}
+	return true, "default allow"
+}
+
+// checkAddr은 "host:port" 형태의 주소를 ACL로 검사합니다.
+// IP 주소가 아닌 주소(Unix 소켓 등)는 규칙 대신 기본 동작을 따릅니다.
+func (a *ACL) checkAddr(address string) (bool, string) {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return a.Check(netip.Addr{})
+	}
+	return a.Check(ap.Addr())
+}
+
+// DenyError는 접근 제어에 의해 거부된 연결을 나타내며, 거부에 사용한 규칙을 담고 있습니다.
+type DenyError struct {
+	Rule string // 일치한 규칙 (예: "deny 10.0.0.0/8", "default deny", "shared secret")
+	Err  error  // 거부 사유 (ErrClientNotAllowed, ErrDestinationNotAllowed, ErrAuthFailed 등)
+}
+
+func (e *DenyError) Error() string { return e.Err.Error() + " (" + e.Rule + ")" }
+
+// Unwrap은 거부 사유를 반환합니다.
+func (e *DenyError) Unwrap() error { return e.Err }
+
+// deny는 거부된 연결을 OnDeny로 알리고 DenyError를 반환합니다.
+func (p *Proxy) deny(conn net.Conn, rule string, reason error) error {
+	err := &DenyError{Rule: rule, Err: reason}
+	if p.OnDeny != nil {
+		p.OnDeny(conn, err)
+	}
+	return err
+}
+
+// checkClient는 ClientACL이 설정되어 있을 때 클라이언트 주소를 검사합니다.
+func (p *Proxy) checkClient(conn net.Conn) error {
+	if p.ClientACL == nil {
+		return nil
+	}
+	if allowed, rule := p.ClientACL.checkAddr(conn.RemoteAddr().String()); !allowed {
+		return p.deny(conn, rule, ErrClientNotAllowed)
+	}
+	return nil
+}
+
+// destinationControl은 업스트림에 연결하기 직전, 이름 해석이 끝난 목적지 주소를 DestinationACL로 검사하는
+// net.Dialer의 Control 함수를 반환합니다. 기존 Control 함수가 있으면 검사를 통과한 뒤 호출합니다.
+func (p *Proxy) destinationControl(client net.Conn, control func(string, string, syscall.RawConn) error) func(string, string, syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		if allowed, rule := p.DestinationACL.checkAddr(address); !allowed {
+			return p.deny(client, rule, ErrDestinationNotAllowed)
+		}
+		if control != nil {
+			return control(network, address, c)
+		}
+		return nil
+	}
+}
+
+// authenticate는 클라이언트가 가장 먼저 보내는 TLV 프레임을 읽어 AuthSecret과 비교합니다.
+// 인증 프레임은 업스트림으로 전달하지 않으며, 그 뒤에 이미 도착한 데이터는 반환한 연결에서 읽을 수 있습니다.
+func (p *Proxy) authenticate(conn net.Conn) (net.Conn, error) {
+	timeout := p.AuthTimeout
+	if timeout <= 0 {
+		timeout = defaultAuthTimeout
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	defer func() { _ = conn.SetReadDeadline(time.Time{}) }()
+
+	r := bufio.NewReader(conn)
+
+	// 큰 페이로드를 할당하기 전에 헤더로 크기를 먼저 확인
+	header, err := r.Peek(frameHeaderSize)
+	if err != nil || binary.BigEndian.Uint32(header[1:]) > maxAuthFrameSize {
+		return nil, p.deny(conn, "shared secret", ErrAuthFailed)
+	}
+
+	payload, err := decode(r)
+	if err != nil {
+		return nil, p.deny(conn, "shared secret", ErrAuthFailed)
+	}
+	if subtle.ConstantTimeCompare(payload.Bytes(), p.AuthSecret) != 1 {
+		return nil, p.deny(conn, "shared secret", ErrAuthFailed)
+	}
+
+	return &bufferedConn{Conn: conn, r: r}, nil
+}
@@ -0,0 +1,178 @@
+package ch04
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// denyRecorder는 OnDeny로 전달된 에러를 채널로 보내는 콜백과 그 채널을 반환합니다.
+func denyRecorder() (func(net.Conn, *DenyError), <-chan *DenyError) {
+	denials := make(chan *DenyError, 1)
+	return func(_ net.Conn, err *DenyError) { denials <- err }, denials
+}
+
+// expectDenial은 지정된 시간 안에 기대한 사유와 규칙으로 거부가 기록되는지 확인합니다.
+func expectDenial(t *testing.T, denials <-chan *DenyError, reason error, rule string) {
+	t.Helper()
+
+	select {
+	case err := <-denials:
+		if !errors.Is(err, reason) || err.Rule != rule {
+			t.Errorf("expected %v (%s); actual %v", reason, rule, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("connection was not denied; expected %v (%s)", reason, rule)
+	}
+}
+
+// TestACLCheck 함수는 규칙을 순서대로 검사하고 처음 일치한 규칙을 적용하는지 테스트합니다.
+func TestACLCheck(t *testing.T) {
+	acl, err := ParseACL(true, "deny 10.1.0.0/16", "allow 10.0.0.0/8", "allow 192.168.1.5", "allow ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr    string
+		allowed bool
+		rule    string
+	}{
+		{"10.2.3.4", true, "allow 10.0.0.0/8"},
+		{"10.1.2.3", false, "deny 10.1.0.0/16"},
+		{"::ffff:10.1.2.3", false, "deny 10.1.0.0/16"},
+		{"192.168.1.5", true, "allow 192.168.1.5/32"},
+		{"192.168.1.6", false, "default deny"},
+		{"::1", true, "allow ::1/128"},
+	}
+
+	for _, tc := range tests {
+		allowed, rule := acl.Check(netip.MustParseAddr(tc.addr))
+		if allowed != tc.allowed || rule != tc.rule {
+			t.Errorf("%s: expected %t (%s); actual %t (%s)", tc.addr, tc.allowed, tc.rule, allowed, rule)
+		}
+	}
+
+	for _, rule := range []string{"allow", "permit 10.0.0.0/8", "deny 10.0.0.0/33", "allow example.com"} {
+		if _, err := ParseACLRule(rule); !errors.Is(err, ErrInvalidACLRule) {
+			t.Errorf("%q: expected ErrInvalidACLRule; actual %v", rule, err)
+		}
+	}
+}
+
+// TestProxyClientACL 함수는 허용되지 않은 클라이언트 주소의 연결을 거부하고 일치한 규칙을 알리는지 테스트합니다.
+func TestProxyClientACL(t *testing.T) {
+	server := newPongServer(t)
+
+	allowed, err := ParseACL(true, "allow 127.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", serveProxy(t, &Proxy{Upstream: server.Addr().String(), ClientACL: allowed}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	pingPong(t, conn)
+
+	denied, err := ParseACL(false, "deny 127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	onDeny, denials := denyRecorder()
+	onClose, reasons := closeRecorder()
+	expectClosed(t, serveProxy(t, &Proxy{
+		Upstream:  server.Addr().String(),
+		ClientACL: denied,
+		OnDeny:    onDeny,
+		OnClose:   onClose,
+	}))
+	expectDenial(t, denials, ErrClientNotAllowed, "deny 127.0.0.1/32")
+	expectReason(t, reasons, CloseRejected)
+}
+
+// TestProxyDestinationACL 함수는 CONNECT 모드에서 이름 해석이 끝난 목적지 주소를 검사하는지 테스트합니다.
+func TestProxyDestinationACL(t *testing.T) {
+	server := newPongServer(t)
+	_, port, _ := net.SplitHostPort(server.Addr().String())
+
+	acl, err := ParseACL(false, "deny 127.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	onDeny, denials := denyRecorder()
+	onClose, reasons := closeRecorder()
+	addr := serveProxy(t, &Proxy{Connect: true, DestinationACL: acl, OnDeny: onDeny, OnClose: onClose})
+
+	// 호스트 이름으로 요청해도 해석된 주소로 검사
+	resp, _ := connectTo(t, addr, net.JoinHostPort("localhost", port))
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status %d; actual %d", http.StatusForbidden, resp.StatusCode)
+	}
+	expectDenial(t, denials, ErrDestinationNotAllowed, "deny 127.0.0.0/8")
+	expectReason(t, reasons, CloseRejected)
+}
+
+// TestProxyAuthSecret 함수는 첫 프레임의 공유 비밀이 일치할 때만 전달을 시작하는지 테스트합니다.
+func TestProxyAuthSecret(t *testing.T) {
+	server := newPongServer(t)
+	onDeny, denials := denyRecorder()
+	addr := serveProxy(t, &Proxy{
+		Upstream:    server.Addr().String(),
+		AuthSecret:  []byte("s3cret"),
+		AuthTimeout: time.Second,
+		OnDeny:      onDeny,
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		// 인증 프레임 뒤에 곧바로 보낸 데이터도 업스트림에 전달되어야 함
+		frame := append(rawFrame(StringType, "s3cret"), "ping"...)
+		if _, err := conn.Write(frame); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 4)
+		if _, err := conn.Read(buf); err != nil || string(buf) != "pong" {
+			t.Fatalf("expected pong; actual %q %v", buf, err)
+		}
+		pingPong(t, conn)
+	})
+
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"wrong secret", rawFrame(BinaryType, "guess")},
+		{"not a frame", []byte("ping")},
+		{"oversized", rawFrame(BinaryType, strings.Repeat("x", maxAuthFrameSize+1))},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if _, err := conn.Write(tc.frame); err != nil {
+				t.Fatal(err)
+			}
+			expectDenial(t, denials, ErrAuthFailed, "shared secret")
+
+			_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+			if _, err := conn.Read(make([]byte, 4)); err == nil || isTimeout(err) {
+				t.Errorf("expected connection to be closed; actual %v", err)
+			}
+		})
+	}
+}
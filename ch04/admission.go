@@ -0,0 +1,159 @@
+package ch04
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// AdmissionPolicy는 동시 연결 수가 가득 찼을 때 새 연결을 처리하는 방식입니다.
+type AdmissionPolicy uint8
+
+// 연결 수락 정책 정의
+const (
+	AdmitReject AdmissionPolicy = iota + 1 // 1 (수락 즉시 연결을 닫음, 기본값)
+	AdmitQueue                             // 2 (QueueTimeout 동안 빈 자리를 기다림)
+)
+
+// defaultMaxQueue는 MaxQueue를 설정하지 않았을 때 빈 자리를 기다릴 수 있는 최대 연결 수입니다.
+const defaultMaxQueue = 1024
+
+// 연결 수 제한 에러 정의
+var (
+	ErrTooManyConns      = errors.New("too many connections")         // 전체 동시 연결 수 초과
+	ErrTooManyConnsPerIP = errors.New("too many connections from IP") // IP별 동시 연결 수 초과
+)
+
+// AdmissionStats는 연결 수 제한에 관한 카운터입니다.
+type AdmissionStats struct {
+	Active        int    // 현재 처리 중인 연결 수
+	Queued        int    // 현재 빈 자리를 기다리는 연결 수
+	RejectedFull  uint64 // 전체 연결 수 제한으로 거부된 연결 수 (대기 시간 초과와 대기열 초과 포함)
+	RejectedPerIP uint64 // IP별 연결 수 제한으로 거부된 연결 수
+	QueueTimeouts uint64 // 대기 중 QueueTimeout이 지나 거부된 연결 수
+	QueueFull     uint64 // 대기 중인 연결이 MaxQueue개여서 기다리지 않고 거부된 연결 수
+}
+
+// admission은 Proxy의 동시 연결 수를 추적합니다.
+type admission struct {
+	mu    sync.Mutex
+	perIP map[string]int
+	freed chan struct{} // 연결이 끝날 때마다 닫아서 대기 중인 모든 연결을 깨우고 새 채널로 교체
+	stats AdmissionStats
+}
+
+// AdmissionStats는 현재 연결 수와 거부된 연결 수를 반환합니다.
+func (p *Proxy) AdmissionStats() AdmissionStats {
+	a := &p.shared().admission
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stats
+}
+
+// admit은 새 연결을 처리할 수 있는지 결정하고, 연결 수를 센 클라이언트 IP를 반환합니다.
+// IP별 제한을 넘으면 바로 거부하고, 전체 제한을 넘으면 WhenFull 정책에 따라 거부하거나 대기합니다.
+// 대기 중인 연결도 파일 디스크립터를 차지하므로, 이미 MaxQueue개의 연결이 기다리고 있으면 바로 거부합니다.
+// 연결마다 별도의 고루틴에서 호출하므로 대기 중인 연결이나 주소를 늦게 알려 주는 연결(PROXY 프로토콜 등)이
+// Accept 루프를 막지 않습니다.
+func (p *Proxy) admit(conn net.Conn) (string, error) {
+	a := &p.shared().admission
+	ip := hostOf(conn.RemoteAddr())
+
+	a.mu.Lock()
+	if a.freed == nil {
+		a.perIP = make(map[string]int)
+		a.freed = make(chan struct{})
+	}
+
+	if p.MaxConnsPerIP > 0 && a.perIP[ip] >= p.MaxConnsPerIP {
+		a.stats.RejectedPerIP++
+		a.mu.Unlock()
+		return ip, ErrTooManyConnsPerIP
+	}
+
+	var timeout <-chan time.Time
+	if p.QueueTimeout > 0 {
+		timer := time.NewTimer(p.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	queued := false // 대기열에 자리를 차지했는지 여부
+	for p.MaxConns > 0 && a.stats.Active >= p.MaxConns {
+		if p.WhenFull != AdmitQueue {
+			a.stats.RejectedFull++
+			a.mu.Unlock()
+			return ip, ErrTooManyConns
+		}
+		if !queued {
+			if a.stats.Queued >= p.maxQueue() {
+				a.stats.RejectedFull++
+				a.stats.QueueFull++
+				a.mu.Unlock()
+				return ip, ErrTooManyConns
+			}
+			a.stats.Queued++
+			queued = true
+		}
+
+		freed := a.freed
+		a.mu.Unlock()
+		select {
+		case <-freed: // 연결 하나가 끝나면 다시 확인
+		case <-timeout:
+			a.mu.Lock()
+			a.stats.Queued--
+			a.stats.RejectedFull++
+			a.stats.QueueTimeouts++
+			a.mu.Unlock()
+			return ip, ErrTooManyConns
+		}
+		a.mu.Lock()
+	}
+	if queued {
+		a.stats.Queued--
+	}
+
+	a.stats.Active++
+	a.perIP[ip]++
+	a.mu.Unlock()
+
+	return ip, nil
+}
+
+// maxQueue는 실제로 적용할 최대 대기 연결 수를 반환합니다.
+func (p *Proxy) maxQueue() int {
+	if p.MaxQueue > 0 {
+		return p.MaxQueue
+	}
+	return defaultMaxQueue
+}
+
+// release는 ip의 연결이 끝났음을 기록하고 대기 중인 연결을 모두 깨웁니다.
+func (p *Proxy) release(ip string) {
+	a := &p.shared().admission
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.stats.Active--
+	if a.perIP[ip]--; a.perIP[ip] <= 0 {
+		delete(a.perIP, ip)
+	}
+	close(a.freed)
+	a.freed = make(chan struct{})
+}
+
+// hostOf는 주소에서 포트를 뺀 호스트 부분을 반환합니다.
+// Unix 소켓처럼 주소가 없는 연결은 빈 문자열을 반환합니다.
+func hostOf(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
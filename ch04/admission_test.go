@@ -0,0 +1,210 @@
+package ch04
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// dialAndPing은 프록시에 연결하고 ping/pong 교환이 되는지 확인한 연결을 반환합니다.
+func dialAndPing(t *testing.T, addr string) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	pingPong(t, conn)
+
+	return conn
+}
+
+// expectClosed는 프록시가 conn을 바로 닫았는지 확인합니다.
+func expectClosed(t *testing.T, addr string) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+	_, _ = conn.Write([]byte("ping"))
+	if _, err := conn.Read(make([]byte, 4)); err == nil || isTimeout(err) {
+		t.Errorf("expected connection to be closed; actual %v", err)
+	}
+}
+
+// TestProxyMaxConns 함수는 최대 동시 연결 수를 넘는 연결이 거부되는지 테스트합니다.
+func TestProxyMaxConns(t *testing.T) {
+	server := newPongServer(t)
+	p := &Proxy{Upstream: server.Addr().String(), MaxConns: 2}
+	addr := serveProxy(t, p)
+
+	dialAndPing(t, addr)
+	dialAndPing(t, addr)
+	expectClosed(t, addr)
+
+	if stats := p.AdmissionStats(); stats.Active != 2 || stats.RejectedFull != 1 {
+		t.Errorf("unexpected admission stats: %+v", stats)
+	}
+}
+
+// TestProxyMaxConnsPerIP 함수는 같은 IP의 동시 연결 수가 제한되는지 테스트합니다.
+func TestProxyMaxConnsPerIP(t *testing.T) {
+	server := newPongServer(t)
+	p := &Proxy{Upstream: server.Addr().String(), MaxConnsPerIP: 1}
+	addr := serveProxy(t, p)
+
+	conn := dialAndPing(t, addr)
+	expectClosed(t, addr)
+
+	// 기존 연결이 끝나면 같은 IP에서 다시 연결할 수 있어야 함
+	_ = conn.Close()
+	time.Sleep(50 * time.Millisecond)
+	dialAndPing(t, addr)
+
+	if stats := p.AdmissionStats(); stats.RejectedPerIP != 1 {
+		t.Errorf("unexpected admission stats: %+v", stats)
+	}
+}
+
+// TestProxyAdmitQueue 함수는 대기 정책에서 빈 자리가 생기면 대기 중인 연결이 처리되고,
+// 시간 안에 자리가 나지 않으면 거부되는지 테스트합니다.
+func TestProxyAdmitQueue(t *testing.T) {
+	server := newPongServer(t)
+	p := &Proxy{
+		Upstream:     server.Addr().String(),
+		MaxConns:     1,
+		WhenFull:     AdmitQueue,
+		QueueTimeout: 200 * time.Millisecond,
+	}
+	addr := serveProxy(t, p)
+
+	// 자리가 나지 않으면 QueueTimeout 후에 거부
+	first := dialAndPing(t, addr)
+	expectClosed(t, addr)
+
+	// 대기 중에 기존 연결이 끝나면 대기하던 연결이 처리됨
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = first.Close()
+	}()
+	dialAndPing(t, addr)
+
+	if stats := p.AdmissionStats(); stats.QueueTimeouts != 1 || stats.RejectedFull != 1 {
+		t.Errorf("unexpected admission stats: %+v", stats)
+	}
+}
+
+// TestProxyAdmitSlowHeader 함수는 PROXY 헤더를 보내지 않아 주소를 알 수 없는 연결이
+// 다른 연결의 수락을 막지 않는지 테스트합니다.
+func TestProxyAdmitSlowHeader(t *testing.T) {
+	server := newPongServer(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	p := &Proxy{Upstream: server.Addr().String(), MaxConnsPerIP: 2}
+	go func() { _ = p.Serve(&ProxyProtocolListener{Listener: listener, HeaderTimeout: 5 * time.Second}) }()
+
+	// 헤더를 보내지 않는 연결: 프록시는 주소를 알기 위해 헤더를 기다림
+	silent, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("PROXY UNKNOWN\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+	pingPong(t, conn)
+}
+
+// TestProxyAdmitQueueMany 함수는 여러 연결이 대기 중일 때 자리가 날 때마다 대기 중인 연결이 차례로 처리되는지 테스트합니다.
+func TestProxyAdmitQueueMany(t *testing.T) {
+	server := newPongServer(t)
+	addr := serveProxy(t, &Proxy{Upstream: server.Addr().String(), MaxConns: 1, WhenFull: AdmitQueue})
+
+	conn := dialAndPing(t, addr)
+	waiting := make(chan net.Conn, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			c, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			t.Cleanup(func() { _ = c.Close() })
+			// 자리가 날 때까지 응답이 없음 (t.Fatal을 쓰지 않도록 pingPong 대신 직접 확인)
+			_ = c.SetDeadline(time.Now().Add(5 * time.Second))
+			buf := make([]byte, 4)
+			if _, err := c.Write([]byte("ping")); err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := io.ReadFull(c, buf); err != nil || string(buf) != "pong" {
+				t.Errorf("expected pong; actual %q %v", buf, err)
+				return
+			}
+			waiting <- c
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		_ = conn.Close()
+		select {
+		case conn = <-waiting:
+		case <-time.After(5 * time.Second):
+			t.Fatal("queued connection was not admitted")
+		}
+	}
+}
+
+// TestProxyAdmitQueueFull 함수는 대기 중인 연결이 MaxQueue개이면 새 연결을 기다리게 하지 않고 바로 닫는지 테스트합니다.
+func TestProxyAdmitQueueFull(t *testing.T) {
+	server := newPongServer(t)
+	p := &Proxy{Upstream: server.Addr().String(), MaxConns: 1, WhenFull: AdmitQueue, MaxQueue: 1}
+	addr := serveProxy(t, p)
+
+	first := dialAndPing(t, addr)
+
+	// 두 번째 연결은 대기열에서 자리를 기다림 (QueueTimeout이 없으므로 무한정)
+	queued, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queued.Close()
+	for deadline := time.Now().Add(time.Second); p.AdmissionStats().Queued != 1; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 1 queued connection; actual %+v", p.AdmissionStats())
+		}
+	}
+
+	// 대기열이 가득 찼으므로 세 번째 연결은 바로 닫힘
+	expectClosed(t, addr)
+	if stats := p.AdmissionStats(); stats.QueueFull != 1 || stats.RejectedFull != 1 || stats.Queued != 1 {
+		t.Errorf("unexpected admission stats: %+v", stats)
+	}
+
+	// 자리가 나면 대기하던 연결이 처리되고 대기열이 비어야 함
+	_ = first.Close()
+	_ = queued.SetDeadline(time.Now().Add(time.Second))
+	pingPong(t, queued)
+	if stats := p.AdmissionStats(); stats.Queued != 0 || stats.Active != 1 {
+		t.Errorf("unexpected admission stats: %+v", stats)
+	}
+}
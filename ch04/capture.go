@@ -0,0 +1,257 @@
+package ch04
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Direction은 캡처된 데이터가 흐른 방향을 나타냅니다.
+type Direction uint8
+
+// 방향 정의
+const (
+	ClientToUpstream Direction = iota + 1 // 1 (클라이언트 → 업스트림)
+	UpstreamToClient                      // 2 (업스트림 → 클라이언트)
+)
+
+// 캡처 파일은 매직 문자열과 시작 시각(유닉스 나노초) 뒤에
+// 방향(1 바이트), 시작 이후 경과 시간(8 바이트), 길이(4 바이트), 데이터로 이루어진 레코드가 이어집니다.
+const captureMagic = "GNPCAP1\n"
+
+// ErrInvalidCapture는 캡처 파일의 형식이 잘못되었을 때 반환됩니다.
+var ErrInvalidCapture = errors.New("invalid capture file")
+
+// CaptureRecord는 캡처 파일의 레코드 하나입니다.
+type CaptureRecord struct {
+	Direction Direction
+	Offset    time.Duration // 캡처 시작 이후 경과 시간
+	Data      []byte
+}
+
+// CaptureWriter는 양방향 데이터를 시간 정보와 함께 캡처 형식으로 기록합니다.
+// 여러 고루틴에서 동시에 사용할 수 있습니다.
+type CaptureWriter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+	err   error // 첫 번째 쓰기 에러 (이후 기록은 무시)
+}
+
+// NewCaptureWriter는 w에 캡처 헤더를 작성하고 CaptureWriter를 생성합니다.
+func NewCaptureWriter(w io.Writer) (*CaptureWriter, error) {
+	start := time.Now()
+	if _, err := io.WriteString(w, captureMagic); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(w, binary.BigEndian, start.UnixNano()); err != nil {
+		return nil, err
+	}
+	return &CaptureWriter{w: w, start: start}, nil
+}
+
+// Record는 dir 방향으로 흐른 data를 현재 시각과 함께 기록합니다.
+func (c *CaptureWriter) Record(dir Direction, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+
+	header := make([]byte, 13)
+	header[0] = byte(dir)
+	binary.BigEndian.PutUint64(header[1:], uint64(time.Since(c.start)))
+	binary.BigEndian.PutUint32(header[9:], uint32(len(data)))
+
+	if _, c.err = c.w.Write(header); c.err != nil {
+		return c.err
+	}
+	_, c.err = c.w.Write(data)
+	return c.err
+}
+
+// ReadCapture는 캡처 파일의 시작 시각과 모든 레코드를 읽습니다.
+func ReadCapture(r io.Reader) (time.Time, []CaptureRecord, error) {
+	magic := make([]byte, len(captureMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != captureMagic {
+		return time.Time{}, nil, ErrInvalidCapture
+	}
+
+	var start int64
+	if err := binary.Read(r, binary.BigEndian, &start); err != nil {
+		return time.Time{}, nil, err
+	}
+
+	var records []CaptureRecord
+	header := make([]byte, 13)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				break // 레코드 경계에서 끝나면 정상 종료
+			}
+			return time.Time{}, nil, err
+		}
+
+		size := binary.BigEndian.Uint32(header[9:])
+		if size > MaxPayloadSize {
+			return time.Time{}, nil, ErrMaxPayloadSize
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return time.Time{}, nil, err
+		}
+
+		records = append(records, CaptureRecord{
+			Direction: Direction(header[0]),
+			Offset:    time.Duration(binary.BigEndian.Uint64(header[1:])),
+			Data:      data,
+		})
+	}
+
+	return time.Unix(0, start), records, nil
+}
+
+// Recorder는 프록시를 통과하는 각 연결을 Dir 디렉터리의 캡처 파일로 기록합니다.
+// 파일 이름은 연결 시작 시각과 클라이언트 주소로 만들어집니다.
+type Recorder struct {
+	Dir string
+
+	// OnError가 설정되면 캡처 파일을 만들거나 쓰거나 닫지 못했을 때 호출됨 (연결은 기록 없이 계속 처리)
+	// 기록 중의 쓰기 에러는 연결마다 처음 한 번만 알림
+	OnError func(err error)
+}
+
+// record는 conn의 읽기와 쓰기를 캡처 파일에 기록하는 연결과, 연결이 끝날 때 호출할 종료 함수를 반환합니다.
+// conn에서 읽은 데이터는 ClientToUpstream, conn에 쓴 데이터는 UpstreamToClient로 기록합니다.
+func (r *Recorder) record(conn net.Conn) (net.Conn, func()) {
+	name := time.Now().Format("20060102T150405.000000000") + "_" +
+		strings.NewReplacer(":", "_", "[", "", "]", "").Replace(conn.RemoteAddr().String()) + ".cap"
+
+	file, err := os.Create(filepath.Join(r.Dir, name))
+	if err != nil {
+		if r.OnError != nil {
+			r.OnError(err)
+		}
+		return conn, func() {}
+	}
+
+	buf := bufio.NewWriter(file)
+	capture, err := NewCaptureWriter(buf)
+	if err != nil {
+		_ = file.Close()
+		if r.OnError != nil {
+			r.OnError(err)
+		}
+		return conn, func() {}
+	}
+
+	c := &captureConn{Conn: conn, capture: capture, onError: r.OnError}
+	done := func() {
+		capture.mu.Lock()
+		writeErr := capture.err
+		err := buf.Flush()
+		if cErr := file.Close(); err == nil {
+			err = cErr
+		}
+		capture.mu.Unlock()
+
+		// 기록 중에 이미 알린 쓰기 에러는 Flush가 같은 에러를 반환하므로 다시 알리지 않음
+		if err != nil && err != writeErr {
+			c.report(err)
+		}
+	}
+
+	return c, done
+}
+
+// captureConn은 읽고 쓴 데이터를 CaptureWriter에 기록하는 net.Conn입니다.
+type captureConn struct {
+	net.Conn
+	capture *CaptureWriter
+	onError func(err error)
+	failed  sync.Once // 기록 에러는 처음 한 번만 알림
+}
+
+// record는 data를 기록하고, 처음 실패했을 때 onError로 알립니다.
+func (c *captureConn) record(dir Direction, data []byte) {
+	if err := c.capture.Record(dir, data); err != nil {
+		c.failed.Do(func() { c.report(err) })
+	}
+}
+
+// report는 onError가 설정되어 있으면 err를 전달합니다.
+func (c *captureConn) report(err error) {
+	if c.onError != nil {
+		c.onError(err)
+	}
+}
+
+// NetConn은 감싼 연결을 반환합니다.
+func (c *captureConn) NetConn() net.Conn { return c.Conn }
+
+func (c *captureConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.record(ClientToUpstream, b[:n])
+	}
+	return n, err
+}
+
+func (c *captureConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.record(UpstreamToClient, b[:n])
+	}
+	return n, err
+}
+
+// Replayer는 캡처한 레코드를 원래의 시간 간격에 맞춰 다시 보냅니다.
+type Replayer struct {
+	Records []CaptureRecord
+
+	// Speed는 재생 속도 배율입니다. 1이면 원래 속도, 2면 두 배 빠르게 재생하며 0이면 기다리지 않습니다.
+	Speed float64
+}
+
+// Replay는 dir 방향의 레코드를 w에 씁니다.
+// 클라이언트 동작을 재현해 서버로 보내려면 ClientToUpstream을,
+// 서버 동작을 재현해 클라이언트로 보내려면 UpstreamToClient를 지정합니다.
+func (r *Replayer) Replay(ctx context.Context, w io.Writer, dir Direction) error {
+	start := time.Now()
+
+	for _, record := range r.Records {
+		if record.Direction != dir {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err // 취소된 뒤에는 더 이상 쓰지 않음
+		}
+
+		if r.Speed > 0 {
+			// 원래 시간 간격을 속도 배율로 나눈 시점까지 대기
+			at := start.Add(time.Duration(float64(record.Offset) / r.Speed))
+			timer := time.NewTimer(time.Until(at))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		if _, err := w.Write(record.Data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package ch04
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestProxyRecorder 함수는 프록시를 통과한 양방향 데이터가 방향과 함께 캡처 파일에 기록되는지 테스트합니다.
+func TestProxyRecorder(t *testing.T) {
+	dir := t.TempDir()
+	server := newPongServer(t)
+	onClose, reasons := closeRecorder()
+	addr := serveProxy(t, &Proxy{
+		Upstream: server.Addr().String(),
+		Recorder: &Recorder{Dir: dir},
+		OnClose:  onClose,
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pingPong(t, conn)
+	pingPong(t, conn)
+	_ = conn.Close()
+	expectReason(t, reasons, CloseClient) // 연결이 끝나야 캡처 파일이 닫힘
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.cap"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one capture file; actual %v (%v)", files, err)
+	}
+
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	_, records, err := ReadCapture(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		dir  Direction
+		data string
+	}{
+		{ClientToUpstream, "ping"},
+		{UpstreamToClient, "pong"},
+		{ClientToUpstream, "ping"},
+		{UpstreamToClient, "pong"},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records; actual %d", len(expected), len(records))
+	}
+	for i, e := range expected {
+		if r := records[i]; r.Direction != e.dir || string(r.Data) != e.data {
+			t.Errorf("%d: expected %d %q; actual %d %q", i, e.dir, e.data, r.Direction, r.Data)
+		}
+		if i > 0 && records[i].Offset < records[i-1].Offset {
+			t.Errorf("%d: offsets are not increasing", i)
+		}
+	}
+}
+
+// failWriter는 limit 바이트까지만 쓰고 이후에는 err를 반환하는 io.Writer입니다.
+type failWriter struct {
+	limit int
+	err   error
+}
+
+func (w *failWriter) Write(b []byte) (int, error) {
+	if len(b) > w.limit {
+		n := w.limit
+		w.limit = 0
+		return n, w.err
+	}
+	w.limit -= len(b)
+	return len(b), nil
+}
+
+// TestCaptureConnError 함수는 캡처 기록에 실패하면 연결은 계속 동작하고 에러를 한 번만 알리는지 테스트합니다.
+func TestCaptureConnError(t *testing.T) {
+	errFull := errors.New("disk full")
+	capture, err := NewCaptureWriter(&failWriter{limit: 16, err: errFull}) // 캡처 헤더만 쓸 수 있음
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reported []error
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := &captureConn{Conn: client, capture: capture, onError: func(err error) { reported = append(reported, err) }}
+	defer conn.Close()
+
+	go func() {
+		buf := make([]byte, 4)
+		for i := 0; i < 2; i++ {
+			_, _ = io.ReadFull(server, buf)
+		}
+	}()
+	for i := 0; i < 2; i++ {
+		if _, err := conn.Write([]byte("pong")); err != nil {
+			t.Fatal(err) // 기록 실패가 연결의 쓰기를 막으면 안 됨
+		}
+	}
+
+	if len(reported) != 1 || reported[0] != errFull {
+		t.Errorf("expected %v reported once; actual %v", errFull, reported)
+	}
+}
+
+// TestReplayer 함수는 캡처를 서버로 다시 보내 같은 응답을 재현하고,
+// 재생 속도 배율에 따라 대기 시간이 줄어드는지 테스트합니다.
+func TestReplayer(t *testing.T) {
+	records := []CaptureRecord{
+		{ClientToUpstream, 0, []byte("ping")},
+		{UpstreamToClient, 10 * time.Millisecond, []byte("pong")},
+		{ClientToUpstream, 200 * time.Millisecond, []byte("echo")},
+		{UpstreamToClient, 210 * time.Millisecond, []byte("echo")},
+	}
+
+	// 캡처 파일로 저장했다가 다시 읽어도 같은 레코드여야 함
+	buf := new(bytes.Buffer)
+	capture, err := NewCaptureWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if err := capture.Record(r.Direction, r.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, read, err := ReadCapture(buf); err != nil || len(read) != len(records) {
+		t.Fatalf("expected %d records; actual %d (%v)", len(records), len(read), err)
+	}
+
+	// 서버로 클라이언트 쪽 데이터를 재생하고, 응답이 캡처된 응답과 같은지 확인
+	server := newPongServer(t)
+	conn, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	replayer := &Replayer{Records: records, Speed: 4}
+	start := time.Now()
+	if err := replayer.Replay(context.Background(), conn, ClientToUpstream); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 150*time.Millisecond {
+		t.Errorf("expected replay at 4x speed to take about 50ms; took %v", elapsed)
+	}
+
+	reply := make([]byte, 8)
+	n := 0
+	for n < len(reply) {
+		m, err := conn.Read(reply[n:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		n += m
+	}
+	if string(reply) != "pongecho" {
+		t.Errorf("expected replies %q; actual %q", "pongecho", reply)
+	}
+
+	// 컨텍스트가 취소되면 재생을 멈춤
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	replayer.Speed = 1
+	if err := replayer.Replay(ctx, new(bytes.Buffer), ClientToUpstream); err != context.Canceled {
+		t.Errorf("expected context canceled; actual %v", err)
+	}
+}
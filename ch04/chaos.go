@@ -0,0 +1,301 @@
+package ch04
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrInjectedReset은 Fault 규칙에 의해 연결이 강제로 리셋되었을 때 반환됩니다.
+var ErrInjectedReset = errors.New("connection reset by fault injection")
+
+// Fault는 프록시 연결에 주입할 장애 규칙입니다.
+// 데이터는 연결에서 읽거나 쓰는 청크 단위로 처리되며, 0인 필드는 적용하지 않습니다.
+type Fault struct {
+	Direction Direction // 적용할 방향 (0이면 양방향)
+
+	Latency   time.Duration // 각 청크를 전달하기 전의 지연
+	Jitter    time.Duration // 지연에 더할 0 ~ Jitter 사이의 무작위 시간
+	Bandwidth int           // 초당 전달할 최대 바이트 수
+
+	DropRate    float64 // 청크를 통째로 버릴 확률 (0 ~ 1)
+	CorruptRate float64 // 각 바이트의 비트 하나를 뒤집을 확률 (0 ~ 1)
+
+	StallAfter int64         // 이 바이트 수를 전달한 뒤 한 번 멈춤
+	Stall      time.Duration // 멈춰 있을 시간
+
+	ResetAfter int64 // 이 바이트 수를 전달한 뒤 연결을 리셋
+}
+
+// Chaos는 프록시 연결에 장애를 주입하는 규칙 모음입니다.
+// SetFaults로 규칙을 바꾸면 이미 연결된 세션에도 다음 청크부터 적용되므로, 테스트 도중 장애를 켜고 끌 수 있습니다.
+type Chaos struct {
+	mu     sync.Mutex
+	faults []*Fault
+	rnd    *rand.Rand
+}
+
+// NewChaos는 seed로 초기화한 난수를 사용하는 Chaos를 생성합니다.
+// 같은 seed와 같은 트래픽이면 같은 장애가 재현됩니다.
+func NewChaos(seed int64, faults ...Fault) *Chaos {
+	c := &Chaos{rnd: rand.New(rand.NewSource(seed))}
+	c.SetFaults(faults...)
+	return c
+}
+
+// SetFaults는 규칙 목록을 교체합니다. 인자가 없으면 모든 장애 주입을 끕니다.
+func (c *Chaos) SetFaults(faults ...Fault) {
+	rules := make([]*Fault, len(faults))
+	for i := range faults {
+		f := faults[i]
+		rules[i] = &f
+	}
+
+	c.mu.Lock()
+	c.faults = rules
+	c.mu.Unlock()
+}
+
+// match는 dir 방향에 적용할 규칙 목록을 반환합니다.
+func (c *Chaos) match(dir Direction) []*Fault {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var rules []*Fault
+	for _, f := range c.faults {
+		if f.Direction == 0 || f.Direction == dir {
+			rules = append(rules, f)
+		}
+	}
+	return rules
+}
+
+// float은 [0, 1) 범위의 난수를 반환합니다.
+func (c *Chaos) float() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rnd.Float64()
+}
+
+// jitter는 [0, max) 범위의 무작위 시간을 반환합니다.
+func (c *Chaos) jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Duration(c.rnd.Int63n(int64(max)))
+}
+
+// corrupt는 data의 각 바이트에서 rate 확률로 비트 하나를 뒤집습니다.
+func (c *Chaos) corrupt(data []byte, rate float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range data {
+		if c.rnd.Float64() < rate {
+			data[i] ^= 1 << c.rnd.Intn(8)
+		}
+	}
+}
+
+// wrap은 conn에서 읽은 데이터(ClientToUpstream)와 conn에 쓸 데이터(UpstreamToClient)에
+// 장애를 주입하는 연결을 반환합니다.
+func (c *Chaos) wrap(conn net.Conn) net.Conn {
+	return &chaosConn{
+		Conn:   conn,
+		chaos:  c,
+		state:  make(map[faultKey]*faultState),
+		closed: make(chan struct{}),
+	}
+}
+
+// faultKey는 규칙과 방향의 조합입니다. 양방향 규칙도 방향마다 상태를 따로 유지합니다.
+type faultKey struct {
+	fault     *Fault
+	direction Direction
+}
+
+// faultState는 연결 하나에서 규칙과 방향별로 유지하는 상태입니다.
+// 한 방향은 하나의 고루틴에서만 처리되므로 별도의 잠금 없이 사용합니다.
+type faultState struct {
+	bytes   int64        // 이 규칙이 적용된 이후 전달한 바이트 수
+	stalled bool         // 이미 한 번 멈췄는지 여부
+	limiter *RateLimiter // Bandwidth 제한용
+}
+
+// chaosConn은 읽고 쓰는 데이터에 Chaos 규칙을 적용하는 net.Conn입니다.
+type chaosConn struct {
+	net.Conn
+	chaos *Chaos
+
+	mu    sync.Mutex
+	state map[faultKey]*faultState
+	reset bool // 리셋된 이후에는 모든 읽기와 쓰기가 실패
+
+	closeOnce sync.Once
+	closed    chan struct{} // 연결이 닫히면 닫혀서 지연과 멈춤 중인 읽기와 쓰기를 깨움
+}
+
+// Close는 지연이나 멈춤 중인 읽기와 쓰기를 깨운 뒤 연결을 닫습니다.
+func (c *chaosConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// sleep은 d 동안 기다립니다. 그 전에 연결이 닫히면 net.ErrClosed를 반환합니다.
+func (c *chaosConn) sleep(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-c.closed:
+		return net.ErrClosed
+	case <-timer.C:
+		return nil
+	}
+}
+
+// stateOf는 dir 방향의 규칙 f에 대한 이 연결의 상태를 반환합니다.
+func (c *chaosConn) stateOf(f *Fault, dir Direction) *faultState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := faultKey{f, dir}
+	s, ok := c.state[key]
+	if !ok {
+		s = &faultState{limiter: NewRateLimiter(f.Bandwidth)}
+		c.state[key] = s
+	}
+	return s
+}
+
+// apply는 dir 방향의 data에 규칙을 적용하고 실제로 전달할 데이터를 반환합니다.
+// data는 직접 수정될 수 있습니다. reset이 true이면 반환된 데이터를 전달한 뒤 연결을 리셋해야 합니다.
+// 지연이나 멈춤 중에 연결이 닫히면 net.ErrClosed를 반환합니다.
+func (c *chaosConn) apply(dir Direction, data []byte) (out []byte, reset bool, err error) {
+	out = data
+	for _, f := range c.chaos.match(dir) {
+		s := c.stateOf(f, dir)
+
+		if f.ResetAfter > 0 && s.bytes+int64(len(out)) >= f.ResetAfter {
+			out = out[:f.ResetAfter-s.bytes] // 정확히 ResetAfter 바이트까지만 전달
+			reset = true
+		}
+		s.bytes += int64(len(out))
+
+		if d := f.Latency + c.chaos.jitter(f.Jitter); d > 0 {
+			if err := c.sleep(d); err != nil {
+				return nil, false, err
+			}
+		}
+		if f.Bandwidth > 0 {
+			if err := waitAll(len(out), c.closed, time.Time{}, s.limiter); err != nil {
+				return nil, false, err
+			}
+		}
+		if f.Stall > 0 && !s.stalled && s.bytes >= f.StallAfter {
+			s.stalled = true
+			if err := c.sleep(f.Stall); err != nil {
+				return nil, false, err
+			}
+		}
+		if f.DropRate > 0 && c.chaos.float() < f.DropRate {
+			return nil, reset, nil
+		}
+		if f.CorruptRate > 0 {
+			c.chaos.corrupt(out, f.CorruptRate)
+		}
+	}
+	return out, reset, nil
+}
+
+// resetConn은 연결을 RST로 끊습니다.
+// 캡처나 TLS 등으로 감싼 연결이면 바탕의 TCP 연결을 찾아 linger를 0으로 설정한 뒤 닫습니다.
+func (c *chaosConn) resetConn() {
+	c.mu.Lock()
+	c.reset = true
+	c.mu.Unlock()
+
+	if tcp := tcpConnOf(c.Conn); tcp != nil {
+		_ = tcp.SetLinger(0)
+	}
+	_ = c.Close()
+}
+
+// tcpConnOf는 감싼 연결을 풀어 바탕의 *net.TCPConn을 반환합니다. TCP 연결이 아니면 nil을 반환합니다.
+func tcpConnOf(conn net.Conn) *net.TCPConn {
+	tcp, _ := baseConn(conn).(*net.TCPConn)
+	return tcp
+}
+
+// baseConn은 NetConn 메서드로 감싼 연결(*tls.Conn과 이 패키지의 연결 래퍼)을 차례로 풀어
+// 가장 안쪽의 연결을 반환합니다.
+func baseConn(conn net.Conn) net.Conn {
+	for {
+		w, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			return conn
+		}
+		conn = w.NetConn()
+	}
+}
+
+// isReset은 연결이 이미 리셋되었는지 확인합니다.
+func (c *chaosConn) isReset() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reset
+}
+
+func (c *chaosConn) Read(b []byte) (int, error) {
+	for {
+		if c.isReset() {
+			return 0, ErrInjectedReset
+		}
+
+		n, err := c.Conn.Read(b)
+		if n == 0 {
+			return 0, err
+		}
+
+		out, reset, aErr := c.apply(ClientToUpstream, b[:n])
+		if aErr != nil {
+			return 0, aErr
+		}
+		if len(out) == 0 && err == nil && !reset {
+			continue // 버려진 청크는 건너뛰고 다음 데이터를 읽음
+		}
+
+		n = copy(b, out)
+		if reset {
+			c.resetConn() // 남은 데이터는 전달하고, 다음 읽기부터 실패
+		}
+		return n, err
+	}
+}
+
+func (c *chaosConn) Write(b []byte) (int, error) {
+	if c.isReset() {
+		return 0, ErrInjectedReset
+	}
+
+	// 호출자의 버퍼를 변조하지 않도록 복사본에 규칙을 적용
+	out, reset, err := c.apply(UpstreamToClient, append([]byte(nil), b...))
+	if err != nil {
+		return 0, err
+	}
+	if len(out) > 0 {
+		if n, err := c.Conn.Write(out); err != nil {
+			return n, err // 일부만 쓰였으면 실제로 쓴 바이트 수를 반환
+		}
+	}
+	if reset {
+		c.resetConn()
+		return len(out), ErrInjectedReset
+	}
+	return len(b), nil // 버려진 데이터도 쓴 것으로 처리
+}
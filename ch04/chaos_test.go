@@ -0,0 +1,191 @@
+package ch04
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestProxyChaosLatency 함수는 지연 규칙이 양방향에 적용되는지 테스트합니다.
+func TestProxyChaosLatency(t *testing.T) {
+	server := newPongServer(t)
+	chaos := NewChaos(1, Fault{Latency: 50 * time.Millisecond, Jitter: 10 * time.Millisecond})
+	addr := serveProxy(t, &Proxy{Upstream: server.Addr().String(), Chaos: chaos})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	pingPong(t, conn)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected round trip of at least 100ms; took %v", elapsed)
+	}
+
+	// 규칙을 끄면 같은 연결에서 바로 지연이 사라져야 함
+	chaos.SetFaults()
+	start = time.Now()
+	pingPong(t, conn)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("expected no latency after SetFaults(); took %v", elapsed)
+	}
+}
+
+// TestProxyChaosCorruptAndDrop 함수는 손상 및 버림 규칙이 지정된 방향에만 적용되는지 테스트합니다.
+func TestProxyChaosCorruptAndDrop(t *testing.T) {
+	server := newPongServer(t)
+	chaos := NewChaos(1, Fault{Direction: ClientToUpstream, CorruptRate: 1})
+	addr := serveProxy(t, &Proxy{Upstream: server.Addr().String(), Chaos: chaos})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 서버는 손상된 "ping"을 받아 그대로 에코하므로 "pong"이 아닌 응답을 받아야 함
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply := string(buf[:n]); reply == "pong" || reply == "ping" {
+		t.Errorf("expected corrupted reply; actual %q", reply)
+	}
+
+	// 모든 청크를 버리면 응답이 없어야 함
+	chaos.SetFaults(Fault{Direction: ClientToUpstream, DropRate: 1})
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := conn.Read(buf); !isTimeout(err) {
+		t.Errorf("expected no reply for dropped data; actual %v", err)
+	}
+}
+
+// TestProxyChaosStall 함수는 지정한 바이트 수 이후 한 번만 멈추는지 테스트합니다.
+func TestProxyChaosStall(t *testing.T) {
+	server := newPongServer(t)
+	chaos := NewChaos(1, Fault{Direction: UpstreamToClient, StallAfter: 8, Stall: 100 * time.Millisecond})
+	addr := serveProxy(t, &Proxy{Upstream: server.Addr().String(), Chaos: chaos})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for i, expected := range []time.Duration{0, 100 * time.Millisecond, 0} {
+		start := time.Now()
+		pingPong(t, conn)
+		elapsed := time.Since(start)
+		if elapsed < expected || (expected == 0 && elapsed > 50*time.Millisecond) {
+			t.Errorf("%d: expected stall of %v; took %v", i, expected, elapsed)
+		}
+	}
+}
+
+// TestProxyChaosReset 함수는 지정한 바이트 수를 전달한 뒤 연결이 리셋되는지 테스트합니다.
+func TestProxyChaosReset(t *testing.T) {
+	server := newPongServer(t)
+	onClose, reasons := closeRecorder()
+	addr := serveProxy(t, &Proxy{
+		Upstream: server.Addr().String(),
+		Chaos:    NewChaos(1, Fault{Direction: UpstreamToClient, ResetAfter: 8}),
+		OnClose:  onClose,
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	pingPong(t, conn)
+	pingPong(t, conn) // 8 바이트째까지는 전달됨
+
+	expectReason(t, reasons, CloseClient)
+	_, _ = conn.Write([]byte("ping"))
+	if _, err := conn.Read(make([]byte, 4)); err == nil {
+		t.Error("expected connection to be reset")
+	}
+}
+
+// TestProxyChaosResetWrapped 함수는 캡처 연결로 감싼 연결도 RST로 리셋되는지 테스트합니다.
+func TestProxyChaosResetWrapped(t *testing.T) {
+	server := newPongServer(t)
+	addr := serveProxy(t, &Proxy{
+		Upstream: server.Addr().String(),
+		Recorder: &Recorder{Dir: t.TempDir()},
+		Chaos:    NewChaos(1, Fault{Direction: UpstreamToClient, ResetAfter: 4}),
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	pingPong(t, conn) // 4 바이트째까지는 전달됨
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 4)); !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("expected connection reset; actual %v", err)
+	}
+}
+
+// TestChaosConnClose 함수는 지연이나 멈춤 중인 쓰기가 연결을 닫으면 바로 끝나는지 테스트합니다.
+func TestChaosConnClose(t *testing.T) {
+	for _, fault := range []Fault{{Latency: time.Hour}, {Stall: time.Hour}} {
+		client, server := net.Pipe()
+		defer server.Close()
+		conn := NewChaos(1, fault).wrap(client)
+
+		errs := make(chan error, 1)
+		go func() {
+			_, err := conn.Write([]byte("pong"))
+			errs <- err
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		_ = conn.Close()
+		select {
+		case err := <-errs:
+			if !errors.Is(err, net.ErrClosed) {
+				t.Errorf("%+v: expected net.ErrClosed; actual %v", fault, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%+v: write did not return after close", fault)
+		}
+	}
+}
+
+// shortConn은 한 번에 최대 limit 바이트만 쓰고 에러를 반환하는 net.Conn입니다.
+type shortConn struct {
+	net.Conn
+	limit int
+}
+
+func (c *shortConn) Write(b []byte) (int, error) {
+	if len(b) > c.limit {
+		return c.limit, io.ErrShortWrite
+	}
+	return len(b), nil
+}
+
+// TestChaosConnShortWrite 함수는 일부만 쓰고 실패하면 실제로 쓴 바이트 수를 반환하는지 테스트합니다.
+func TestChaosConnShortWrite(t *testing.T) {
+	conn := NewChaos(1).wrap(&shortConn{limit: 2})
+	if n, err := conn.Write([]byte("pong")); n != 2 || err != io.ErrShortWrite {
+		t.Errorf("expected 2 bytes and %v; actual %d and %v", io.ErrShortWrite, n, err)
+	}
+}
@@ -0,0 +1,413 @@
+package ch04
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrInvalidConfig는 설정 파일의 내용이 올바르지 않을 때 반환됩니다.
+var ErrInvalidConfig = errors.New("invalid proxy config")
+
+// Duration은 설정 파일에서 "1.5s", "300ms"처럼 문자열로 적는 시간 값입니다.
+type Duration time.Duration
+
+// UnmarshalJSON은 time.ParseDuration 형식의 문자열을 해석합니다.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON은 시간 값을 time.Duration의 문자열 형식으로 변환합니다.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Config는 JSON 설정 파일로 선언하는 프록시 경로 목록입니다.
+type Config struct {
+	Routes []RouteConfig `json:"routes"`
+}
+
+// RouteConfig는 리스너 하나와 그 리스너로 들어온 연결을 처리할 프록시 설정입니다.
+// 경로는 Name으로 구분하며, 설정을 다시 적용할 때 내용이 같은 경로는 그대로 유지됩니다.
+type RouteConfig struct {
+	Name      string   `json:"name"`
+	Listen    string   `json:"listen"`              // 리스너 주소 ("unix://" 접두사가 있으면 Unix 소켓)
+	Upstreams []string `json:"upstreams,omitempty"` // 라운드 로빈으로 선택할 업스트림 주소 목록
+	Connect   bool     `json:"connect,omitempty"`   // HTTP CONNECT 터널링 모드 사용 여부
+	Allow     []string `json:"allow,omitempty"`     // CONNECT 모드에서 허용할 목적지 목록
+
+	DialTimeout Duration `json:"dial_timeout,omitempty"`
+	IdleTimeout Duration `json:"idle_timeout,omitempty"`
+	MaxLifetime Duration `json:"max_lifetime,omitempty"`
+
+	MaxConns      int      `json:"max_conns,omitempty"`
+	MaxConnsPerIP int      `json:"max_conns_per_ip,omitempty"`
+	Queue         bool     `json:"queue,omitempty"` // 최대 연결 수에 도달하면 거부하지 않고 대기
+	QueueTimeout  Duration `json:"queue_timeout,omitempty"`
+	MaxQueue      int      `json:"max_queue,omitempty"` // 대기할 수 있는 최대 연결 수
+
+	ClientACL   []string `json:"client_acl,omitempty"` // ParseACLRule 형식의 클라이언트 주소 규칙
+	DefaultDeny bool     `json:"default_deny,omitempty"`
+
+	TLS         *TLSFiles `json:"tls,omitempty"`          // 설정되면 클라이언트 연결의 TLS를 종료
+	UpstreamTLS *TLSFiles `json:"upstream_tls,omitempty"` // 설정되면 업스트림 연결을 TLS로 암호화
+}
+
+// TLSFiles는 TLS 설정에 사용할 파일 경로입니다.
+// 클라이언트 쪽에는 CertFile과 KeyFile이 필요하고, 업스트림 쪽에서는 CAFile과 ServerName만 사용합니다.
+type TLSFiles struct {
+	CertFile   string `json:"cert_file,omitempty"`
+	KeyFile    string `json:"key_file,omitempty"`
+	CAFile     string `json:"ca_file,omitempty"`     // 업스트림 인증서를 검증할 CA 번들 (비어 있으면 시스템 인증서)
+	ServerName string `json:"server_name,omitempty"` // 업스트림 인증서를 검증할 이름 (비어 있으면 주소의 호스트)
+}
+
+// LoadConfig는 설정 파일을 읽고 검증합니다. 알 수 없는 필드가 있으면 오타로 보고 에러를 반환합니다.
+func LoadConfig(file string) (*Config, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	cfg := new(Config)
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate는 경로 이름과 리스너 주소가 겹치지 않는지, 각 경로로 프록시를 만들 수 있는지 확인합니다.
+func (c *Config) Validate() error {
+	_, err := c.proxies()
+	return err
+}
+
+// proxies는 설정을 검증하면서 경로 이름별로 프록시를 생성합니다.
+func (c *Config) proxies() (map[string]*Proxy, error) {
+	proxies := make(map[string]*Proxy)
+	listens := make(map[string]bool)
+
+	for _, rc := range c.Routes {
+		switch {
+		case rc.Name == "":
+			return nil, fmt.Errorf("%w: route without name", ErrInvalidConfig)
+		case proxies[rc.Name] != nil:
+			return nil, fmt.Errorf("%w: duplicate route %q", ErrInvalidConfig, rc.Name)
+		case listens[rc.Listen] && !ephemeral(rc.Listen):
+			return nil, fmt.Errorf("%w: route %q: duplicate listen address %q", ErrInvalidConfig, rc.Name, rc.Listen)
+		}
+		listens[rc.Listen] = true
+
+		p, err := rc.proxy()
+		if err != nil {
+			return nil, err
+		}
+		proxies[rc.Name] = p
+	}
+	return proxies, nil
+}
+
+// ephemeral은 listen이 임의의 포트를 할당받는 주소인지 확인합니다. 이런 주소는 여러 경로가 함께 쓸 수 있습니다.
+func ephemeral(listen string) bool {
+	network, address := splitNetwork(listen)
+	_, port, err := net.SplitHostPort(address)
+	return network != "unix" && err == nil && port == "0"
+}
+
+// proxy는 경로 설정으로 Proxy를 생성합니다. 인증서 파일 등을 읽지 못하면 에러를 반환합니다.
+func (rc RouteConfig) proxy() (*Proxy, error) {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: route %q: %s", ErrInvalidConfig, rc.Name, fmt.Sprintf(format, args...))
+	}
+
+	if rc.Listen == "" {
+		return nil, invalid("missing listen address")
+	}
+	if !rc.Connect && len(rc.Upstreams) == 0 {
+		return nil, invalid("missing upstreams")
+	}
+	if rc.MaxConns < 0 || rc.MaxConnsPerIP < 0 || rc.MaxQueue < 0 {
+		return nil, invalid("negative connection limit")
+	}
+
+	p := &Proxy{
+		Upstreams:     rc.Upstreams,
+		Connect:       rc.Connect,
+		Allow:         rc.Allow,
+		DialTimeout:   time.Duration(rc.DialTimeout),
+		IdleTimeout:   time.Duration(rc.IdleTimeout),
+		MaxLifetime:   time.Duration(rc.MaxLifetime),
+		MaxConns:      rc.MaxConns,
+		MaxConnsPerIP: rc.MaxConnsPerIP,
+		QueueTimeout:  time.Duration(rc.QueueTimeout),
+		MaxQueue:      rc.MaxQueue,
+	}
+	if rc.Queue {
+		p.WhenFull = AdmitQueue
+	}
+
+	if len(rc.ClientACL) > 0 || rc.DefaultDeny {
+		acl, err := ParseACL(rc.DefaultDeny, rc.ClientACL...)
+		if err != nil {
+			return nil, invalid("%v", err)
+		}
+		p.ClientACL = acl
+	}
+
+	if rc.TLS != nil {
+		cert, err := tls.LoadX509KeyPair(rc.TLS.CertFile, rc.TLS.KeyFile)
+		if err != nil {
+			return nil, invalid("%v", err)
+		}
+		p.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	if rc.UpstreamTLS != nil {
+		p.UpstreamTLS = &tls.Config{ServerName: rc.UpstreamTLS.ServerName}
+		if rc.UpstreamTLS.CAFile != "" {
+			pool, err := LoadCABundle(rc.UpstreamTLS.CAFile)
+			if err != nil {
+				return nil, invalid("%v", err)
+			}
+			p.UpstreamTLS.RootCAs = pool
+		}
+	}
+
+	return p, nil
+}
+
+// RouteManager는 Config에 선언된 경로마다 리스너를 열고 프록시를 실행합니다.
+// Apply로 새 설정을 적용하면 바뀌지 않은 경로는 그대로 두고, 추가된 경로의 리스너를 열고
+// 삭제된 경로의 리스너를 닫습니다. 설정이 바뀐 경로는 리스너를 유지한 채 새 연결부터 새 설정을 적용하며,
+// 이미 처리 중인 연결은 어떤 경우에도 끊지 않습니다.
+// 연결 수 제한에 쓰이는 연결 수와 통계는 경로 이름별로 이어지므로, 설정을 바꿔도 처리 중인 연결이 제한에 포함됩니다.
+type RouteManager struct {
+	// OnClose와 OnDeny가 설정되면 모든 경로의 프록시에 그대로 전달됨
+	OnClose func(conn net.Conn, reason CloseReason, err error)
+	OnDeny  func(conn net.Conn, err *DenyError)
+
+	// OnReload가 설정되면 Watch에 의한 자동 재적용이 끝날 때마다 결과와 함께 호출됨
+	OnReload func(err error)
+
+	mu     sync.Mutex
+	routes map[string]*route
+}
+
+// route는 실행 중인 경로 하나입니다.
+type route struct {
+	config   RouteConfig
+	listener net.Listener
+
+	mu    sync.RWMutex
+	proxy *Proxy
+}
+
+// current는 새 연결에 사용할 프록시를 반환합니다.
+func (r *route) current() *Proxy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.proxy
+}
+
+// serve는 리스너를 닫을 때까지 연결을 수락하고, 수락할 때마다 현재 설정의 프록시로 넘깁니다.
+func (r *route) serve() {
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+		r.current().serveConn(conn)
+	}
+}
+
+// Apply는 cfg를 검증하고 적용합니다.
+// 검증에 실패하거나 새 리스너를 하나라도 열지 못하면 아무것도 바꾸지 않고 이전 설정을 유지합니다.
+func (m *RouteManager) Apply(cfg *Config) error {
+	proxies, err := cfg.proxies()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 새 설정에서 더 이상 같은 주소로 쓰이지 않는 경로의 리스너는 같은 주소를 쓰는 다른 경로가 넘겨받을 수 있음
+	free := make(map[string][]*route)
+	for name, r := range m.routes {
+		if rc, ok := cfg.route(name); !ok || rc.Listen != r.config.Listen {
+			free[r.config.Listen] = append(free[r.config.Listen], r)
+		}
+	}
+
+	// 먼저 모든 프록시를 만들고 필요한 리스너를 열어 둔 뒤, 전부 성공했을 때만 교체
+	type update struct {
+		route  *route
+		config RouteConfig
+		proxy  *Proxy
+	}
+	var (
+		updates []update
+		started []*route
+	)
+	next := make(map[string]*route)
+	abort := func(err error) error {
+		for _, r := range started {
+			_ = r.listener.Close()
+		}
+		return err
+	}
+
+	for _, rc := range cfg.Routes {
+		old, ok := m.routes[rc.Name]
+		if ok && reflect.DeepEqual(old.config, rc) {
+			next[rc.Name] = old // 바뀌지 않은 경로
+			continue
+		}
+
+		p := proxies[rc.Name]
+		p.OnClose, p.OnDeny = m.OnClose, m.OnDeny
+		if ok {
+			p.state = old.current().shared() // 같은 이름의 경로는 연결 수와 통계를 이어받음
+		}
+
+		r := old
+		if !ok || old.config.Listen != rc.Listen {
+			if held := free[rc.Listen]; len(held) > 0 {
+				r, free[rc.Listen] = held[0], held[1:] // 같은 주소를 쓰던 경로의 리스너를 넘겨받음
+			} else {
+				network, address := splitNetwork(rc.Listen)
+				l, err := net.Listen(network, address)
+				if err != nil {
+					return abort(fmt.Errorf("%w: route %q: %v", ErrInvalidConfig, rc.Name, err))
+				}
+				r = &route{config: rc, listener: l, proxy: p}
+				started = append(started, r)
+			}
+		}
+		updates = append(updates, update{r, rc, p})
+		next[rc.Name] = r
+	}
+
+	// 새 리스너의 Accept 루프를 시작하고, 설정이 바뀐 경로는 새 연결부터 새 프록시를 사용
+	for _, r := range started {
+		go r.serve()
+	}
+	for _, u := range updates {
+		u.route.mu.Lock()
+		u.route.config, u.route.proxy = u.config, u.proxy
+		u.route.mu.Unlock()
+	}
+
+	// 아무도 넘겨받지 않은 리스너를 닫음 (처리 중인 연결은 유지됨)
+	for _, held := range free {
+		for _, r := range held {
+			_ = r.listener.Close()
+		}
+	}
+	m.routes = next
+
+	return nil
+}
+
+// route는 name 경로의 설정을 찾습니다.
+func (c *Config) route(name string) (RouteConfig, bool) {
+	for _, rc := range c.Routes {
+		if rc.Name == name {
+			return rc, true
+		}
+	}
+	return RouteConfig{}, false
+}
+
+// Addr은 name 경로의 리스너 주소를 반환합니다. 실행 중인 경로가 없으면 nil을 반환합니다.
+func (m *RouteManager) Addr(name string) net.Addr {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := m.routes[name]; ok {
+		return r.listener.Addr()
+	}
+	return nil
+}
+
+// Close는 모든 경로의 리스너를 닫습니다. 처리 중인 연결은 끝날 때까지 유지됩니다.
+func (m *RouteManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, r := range m.routes {
+		_ = r.listener.Close()
+		delete(m.routes, name)
+	}
+	return nil
+}
+
+// Watch는 SIGHUP 신호를 받거나 interval마다 확인한 설정 파일의 수정 시각이 바뀌면 설정을 다시 읽어 적용합니다.
+// interval이 0 이하이면 defaultWatchInterval을 사용합니다.
+// 잘못된 설정은 적용하지 않고 OnReload로 에러를 알립니다. ctx가 취소되면 감시를 멈춥니다.
+func (m *RouteManager) Watch(ctx context.Context, file string, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var seen time.Time
+	if info, err := os.Stat(file); err == nil {
+		seen = info.ModTime()
+	}
+
+	go func() {
+		defer signal.Stop(hup)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup: // SIGHUP을 받으면 무조건 다시 읽음
+			case <-ticker.C:
+				info, err := os.Stat(file)
+				if err != nil || info.ModTime().Equal(seen) {
+					continue
+				}
+				seen = info.ModTime()
+			}
+
+			cfg, err := LoadConfig(file)
+			if err == nil {
+				err = m.Apply(cfg)
+			}
+			if m.OnReload != nil {
+				m.OnReload(err)
+			}
+		}
+	}()
+}
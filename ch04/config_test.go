@@ -0,0 +1,244 @@
+package ch04
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// routeConn은 manager의 name 경로로 연결합니다.
+func routeConn(t *testing.T, m *RouteManager, name string) net.Conn {
+	t.Helper()
+
+	addr := m.Addr(name)
+	if addr == nil {
+		t.Fatalf("route %q is not running", name)
+	}
+	conn, err := net.Dial(addr.Network(), addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// TestLoadConfig 함수는 설정 파일을 해석하고 잘못된 설정을 거부하는지 테스트합니다.
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		file := filepath.Join(dir, "proxy.json")
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	cfg, err := LoadConfig(write(`{"routes": [{
+		"name": "api", "listen": "127.0.0.1:0", "upstreams": ["10.0.0.1:80", "10.0.0.2:80"],
+		"idle_timeout": "1m30s", "max_conns": 10, "client_acl": ["allow 10.0.0.0/8"], "default_deny": true
+	}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := cfg.Routes[0].proxy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.IdleTimeout != 90*time.Second || p.MaxConns != 10 || len(p.Upstreams) != 2 || !p.ClientACL.DefaultDeny {
+		t.Errorf("unexpected proxy: %+v", p)
+	}
+
+	invalid := map[string]string{
+		"unknown field":  `{"routes": [{"name": "a", "listen": ":0", "upstream": ["x:1"]}]}`,
+		"bad duration":   `{"routes": [{"name": "a", "listen": ":0", "upstreams": ["x:1"], "idle_timeout": "soon"}]}`,
+		"no upstreams":   `{"routes": [{"name": "a", "listen": ":0"}]}`,
+		"duplicate name": `{"routes": [{"name": "a", "listen": ":0", "connect": true}, {"name": "a", "listen": ":0", "connect": true}]}`,
+		"duplicate listen": `{"routes": [{"name": "a", "listen": ":9000", "connect": true},
+			{"name": "b", "listen": ":9000", "connect": true}]}`,
+		"bad acl":     `{"routes": [{"name": "a", "listen": ":0", "connect": true, "client_acl": ["allow nowhere"]}]}`,
+		"missing tls": `{"routes": [{"name": "a", "listen": ":0", "connect": true, "tls": {"cert_file": "none.pem"}}]}`,
+	}
+	for name, content := range invalid {
+		if _, err := LoadConfig(write(content)); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: expected ErrInvalidConfig; actual %v", name, err)
+		}
+	}
+}
+
+// TestRouteManagerApply 함수는 설정을 다시 적용할 때 바뀌지 않은 경로와 기존 연결을 유지하고,
+// 잘못된 설정은 거부하는지 테스트합니다.
+func TestRouteManagerApply(t *testing.T) {
+	server := newPongServer(t)
+	upstreams := []string{server.Addr().String()}
+
+	m := new(RouteManager)
+	defer m.Close()
+
+	a := RouteConfig{Name: "a", Listen: "127.0.0.1:0", Upstreams: upstreams}
+	if err := m.Apply(&Config{Routes: []RouteConfig{a}}); err != nil {
+		t.Fatal(err)
+	}
+	addrA := m.Addr("a").String()
+	connA := routeConn(t, m, "a")
+	pingPong(t, connA)
+
+	// 경로 추가: 기존 경로의 리스너와 연결은 그대로 유지
+	b := RouteConfig{Name: "b", Listen: "127.0.0.1:0", Upstreams: upstreams}
+	if err := m.Apply(&Config{Routes: []RouteConfig{a, b}}); err != nil {
+		t.Fatal(err)
+	}
+	if m.Addr("a").String() != addrA {
+		t.Errorf("route a was restarted: %s -> %s", addrA, m.Addr("a"))
+	}
+	pingPong(t, connA)
+	pingPong(t, routeConn(t, m, "b"))
+
+	// 경로 설정 변경: 새 연결부터 새 설정을 적용하고, 기존 연결은 이전 설정으로 계속 동작
+	onClose, reasons := closeRecorder()
+	m.OnClose = onClose
+	a.IdleTimeout = Duration(100 * time.Millisecond)
+	if err := m.Apply(&Config{Routes: []RouteConfig{a, b}}); err != nil {
+		t.Fatal(err)
+	}
+	idle := routeConn(t, m, "a")
+	pingPong(t, idle)
+	expectReason(t, reasons, CloseIdleTimeout)
+	pingPong(t, connA)
+
+	// 잘못된 설정은 거부하고 이전 설정을 유지
+	bad := RouteConfig{Name: "c", Listen: "127.0.0.1:0"}
+	if err := m.Apply(&Config{Routes: []RouteConfig{a, bad}}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected ErrInvalidConfig; actual %v", err)
+	}
+	pingPong(t, routeConn(t, m, "b"))
+
+	// 경로 삭제: 리스너는 닫히지만 처리 중인 연결은 유지
+	addrB := m.Addr("b").String()
+	connB := routeConn(t, m, "b")
+	if err := m.Apply(&Config{Routes: []RouteConfig{a}}); err != nil {
+		t.Fatal(err)
+	}
+	if m.Addr("b") != nil {
+		t.Error("expected route b to be removed")
+	}
+	if conn, err := net.Dial("tcp", addrB); err == nil {
+		_ = conn.Close()
+		t.Error("expected listener of route b to be closed")
+	}
+	pingPong(t, connB)
+
+	// 이름만 바뀐 경로는 같은 주소의 리스너를 넘겨받음
+	a.Name = "renamed"
+	if err := m.Apply(&Config{Routes: []RouteConfig{a}}); err != nil {
+		t.Fatal(err)
+	}
+	if addr := m.Addr("renamed"); addr == nil || addr.String() != addrA {
+		t.Errorf("expected listener %s to be reused; actual %v", addrA, addr)
+	}
+	pingPong(t, connA)
+	pingPong(t, routeConn(t, m, "renamed"))
+}
+
+// TestRouteManagerWatch 함수는 설정 파일이 바뀌면 다시 읽어 적용하고,
+// 잘못된 파일은 적용하지 않는지 테스트합니다.
+func TestRouteManagerWatch(t *testing.T) {
+	server := newPongServer(t)
+	file := filepath.Join(t.TempDir(), "proxy.json")
+	write := func(content string, mtime time.Time) {
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_ = os.Chtimes(file, mtime, mtime) // 파일 시스템의 시각 정밀도와 상관없이 변경을 감지하도록 설정
+	}
+	route := `{"name": "%s", "listen": "127.0.0.1:0", "upstreams": ["` + server.Addr().String() + `"]}`
+
+	write(`{"routes": [`+fmt.Sprintf(route, "a")+`]}`, time.Now().Add(-time.Hour))
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := new(RouteManager)
+	defer m.Close()
+	if err := m.Apply(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	reloads := make(chan error, 1)
+	m.OnReload = func(err error) { reloads <- err }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.Watch(ctx, file, 10*time.Millisecond)
+
+	expectReload := func() error {
+		t.Helper()
+		select {
+		case err := <-reloads:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("config was not reloaded")
+			return nil
+		}
+	}
+
+	write(`{"routes": [`+fmt.Sprintf(route, "a")+`, `+fmt.Sprintf(route, "b")+`]}`, time.Now().Add(-time.Minute))
+	if err := expectReload(); err != nil {
+		t.Fatal(err)
+	}
+	pingPong(t, routeConn(t, m, "b"))
+
+	write(`{"routes": [`, time.Now())
+	if err := expectReload(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected ErrInvalidConfig; actual %v", err)
+	}
+	pingPong(t, routeConn(t, m, "a"))
+	pingPong(t, routeConn(t, m, "b"))
+}
+
+// TestRouteManagerSharedState 함수는 경로 설정을 바꿔도 처리 중인 연결이 연결 수 제한에 포함되고
+// 통계가 이어지는지 테스트합니다.
+func TestRouteManagerSharedState(t *testing.T) {
+	server := newPongServer(t)
+
+	m := new(RouteManager)
+	defer m.Close()
+
+	a := RouteConfig{Name: "a", Listen: "127.0.0.1:0", Upstreams: []string{server.Addr().String()}, MaxConns: 1}
+	if err := m.Apply(&Config{Routes: []RouteConfig{a}}); err != nil {
+		t.Fatal(err)
+	}
+	held := routeConn(t, m, "a")
+	pingPong(t, held)
+
+	// 설정을 바꿔도 이전 설정으로 처리 중인 연결이 최대 연결 수를 차지함
+	onClose, reasons := closeRecorder()
+	m.OnClose = onClose
+	a.IdleTimeout = Duration(time.Minute)
+	if err := m.Apply(&Config{Routes: []RouteConfig{a}}); err != nil {
+		t.Fatal(err)
+	}
+	routeConn(t, m, "a")
+	expectReason(t, reasons, CloseRejected)
+
+	m.mu.Lock()
+	p := m.routes["a"].current()
+	m.mu.Unlock()
+	if stats := p.Stats(); stats.Total != 1 || stats.Active != 1 || stats.Closed[CloseRejected] != 1 {
+		t.Errorf("expected stats to carry over; actual %+v", stats)
+	}
+	if stats := p.AdmissionStats(); stats.Active != 1 || stats.RejectedFull != 1 {
+		t.Errorf("expected admission to carry over; actual %+v", stats)
+	}
+
+	// 처리 중인 연결이 끝나면 새 설정에서도 자리가 남
+	_ = held.Close()
+	for deadline := time.Now().Add(time.Second); p.AdmissionStats().Active > 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	pingPong(t, routeConn(t, m, "a"))
+}
@@ -0,0 +1,116 @@
+package ch04
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// CONNECT 터널링 에러 정의
+var (
+	ErrMethodNotAllowed      = errors.New("method not allowed")      // CONNECT 이외의 메서드
+	ErrDestinationNotAllowed = errors.New("destination not allowed") // 허용 목록에 없는 목적지
+)
+
+// bufferedConn은 bufio.Reader에 이미 읽혀 있는 데이터를 먼저 반환하는 net.Conn입니다.
+// CONNECT 요청 헤더 뒤에 클라이언트가 바로 보낸 데이터를 잃지 않기 위해 사용합니다.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// NetConn은 감싼 연결을 반환합니다.
+func (c *bufferedConn) NetConn() net.Conn { return c.Conn }
+
+// Read는 버퍼에 남은 데이터를 먼저 읽고, 이후에는 원래 연결에서 읽습니다.
+func (c *bufferedConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+// serveConnect는 클라이언트의 HTTP CONNECT 요청을 읽고 목적지로 연결한 뒤
+// "200 Connection Established" 응답을 보냅니다.
+// 이후 데이터 전달에 사용할 클라이언트 연결과 업스트림 연결을 반환합니다.
+func (p *Proxy) serveConnect(from net.Conn) (net.Conn, net.Conn, error) {
+	// 요청을 보내지 않는 클라이언트가 연결을 붙잡고 있지 않도록 요청을 읽는 동안 데드라인 적용
+	_ = from.SetReadDeadline(time.Now().Add(p.handshakeTimeout()))
+	r := bufio.NewReader(from)
+	req, err := http.ReadRequest(r) // CONNECT 요청 읽기
+	_ = from.SetReadDeadline(time.Time{})
+	if err != nil {
+		if isTimeout(err) {
+			writeStatus(from, http.StatusRequestTimeout) // 제한 시간 안에 요청을 보내지 않음
+		} else {
+			writeStatus(from, http.StatusBadRequest)
+		}
+		return nil, nil, err
+	}
+
+	if req.Method != http.MethodConnect {
+		writeStatus(from, http.StatusMethodNotAllowed) // CONNECT 이외의 요청은 거부
+		return nil, nil, ErrMethodNotAllowed
+	}
+
+	// CONNECT 요청의 목적지는 "host:port" 형태의 Host 값
+	destination := req.Host
+	if !p.allowed(destination) {
+		writeStatus(from, http.StatusForbidden) // 허용 목록에 없는 목적지
+		return nil, nil, ErrDestinationNotAllowed
+	}
+
+	to, err := p.dial(from, "tcp", destination) // CONNECT 목적지는 항상 TCP
+	if err != nil {
+		// 접근 제어에 의해 거부되면 403, 타임아웃이면 504, 그 외의 연결 실패는 502 응답
+		var (
+			nErr    net.Error
+			denyErr *DenyError
+		)
+		if errors.As(err, &denyErr) {
+			writeStatus(from, http.StatusForbidden)
+		} else if errors.As(err, &nErr) && nErr.Timeout() {
+			writeStatus(from, http.StatusGatewayTimeout)
+		} else {
+			writeStatus(from, http.StatusBadGateway)
+		}
+		return nil, nil, err
+	}
+
+	_, err = fmt.Fprint(from, "HTTP/1.1 200 Connection Established\r\n\r\n")
+	if err != nil {
+		_ = to.Close()
+		return nil, nil, err
+	}
+
+	return &bufferedConn{Conn: from, r: r}, to, nil
+}
+
+// allowed는 목적지가 Allow 목록에 포함되는지 확인합니다.
+// 목록의 각 항목은 "host:port" 형태이며, host나 port 자리에 "*"를 쓰면 모든 값과 일치합니다.
+func (p *Proxy) allowed(destination string) bool {
+	if len(p.Allow) == 0 {
+		return true // 허용 목록이 없으면 모든 목적지 허용
+	}
+
+	host, port, err := net.SplitHostPort(destination)
+	if err != nil {
+		return false
+	}
+
+	for _, rule := range p.Allow {
+		ruleHost, rulePort, err := net.SplitHostPort(rule)
+		if err != nil {
+			continue // 잘못된 규칙은 무시
+		}
+		if (ruleHost == "*" || ruleHost == host) && (rulePort == "*" || rulePort == port) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeStatus는 본문이 없는 HTTP 응답을 작성합니다.
+func writeStatus(conn net.Conn, code int) {
+	_, _ = fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\nContent-Length: 0\r\nConnection: close\r\n\r\n",
+		code, http.StatusText(code))
+}
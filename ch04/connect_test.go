@@ -0,0 +1,124 @@
+package ch04
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+)
+
+// connectTo는 프록시에 CONNECT 요청을 보내고 응답과 연결을 반환합니다.
+func connectTo(t *testing.T, proxyAddr, destination string) (*http.Response, net.Conn) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	_, err = fmt.Fprintf(conn, "CONNECT %[1]s HTTP/1.1\r\nHost: %[1]s\r\n\r\n", destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, conn
+}
+
+// TestProxyConnect 함수는 CONNECT 터널을 통해 서버와 통신할 수 있는지 테스트합니다.
+func TestProxyConnect(t *testing.T) {
+	server := newPongServer(t)
+	addr := serveProxy(t, &Proxy{
+		Connect: true,
+		Allow:   []string{server.Addr().String()},
+	})
+
+	resp, conn := connectTo(t, addr, server.Addr().String())
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d; actual %d", http.StatusOK, resp.StatusCode)
+	}
+
+	// 터널이 열린 뒤에는 서버와 직접 통신하는 것과 같아야 함
+	pingPong(t, conn)
+	pingPong(t, conn)
+}
+
+// TestProxyConnectStatus 함수는 거부 및 연결 실패 시 올바른 상태 코드를 반환하는지 테스트합니다.
+func TestProxyConnectStatus(t *testing.T) {
+	server := newPongServer(t)
+
+	// 닫힌 포트를 얻기 위해 리스너를 만들었다가 바로 닫음
+	closed, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	_ = closed.Close()
+
+	allow := []string{server.Addr().String(), closedAddr, "10.0.0.1:*"}
+
+	// 연결 시도 시 항상 타임아웃 에러를 반환하는 Dialer
+	timeoutDialer := &net.Dialer{
+		Control: func(_, addr string, _ syscall.RawConn) error {
+			return &net.DNSError{
+				Err:         "connection timed out",
+				Name:        addr,
+				Server:      "127.0.0.1",
+				IsTimeout:   true,
+				IsTemporary: true,
+			}
+		},
+	}
+
+	tests := []struct {
+		name        string
+		proxy       *Proxy
+		destination string
+		status      int
+	}{
+		{"forbidden", &Proxy{Connect: true, Allow: allow}, "127.0.0.1:1", http.StatusForbidden},
+		{"bad gateway", &Proxy{Connect: true, Allow: allow}, closedAddr, http.StatusBadGateway},
+		{"gateway timeout", &Proxy{Connect: true, Allow: allow, Dialer: timeoutDialer},
+			"10.0.0.1:80", http.StatusGatewayTimeout},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, _ := connectTo(t, serveProxy(t, tc.proxy), tc.destination)
+			if resp.StatusCode != tc.status {
+				t.Errorf("expected status %d; actual %d", tc.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+// TestProxyConnectMethod 함수는 CONNECT 이외의 요청을 거부하는지 테스트합니다.
+func TestProxyConnectMethod(t *testing.T) {
+	addr := serveProxy(t, &Proxy{Connect: true})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d; actual %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
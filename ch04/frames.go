@@ -0,0 +1,145 @@
+package ch04
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// FramePolicy는 최대 크기를 넘거나 타입을 알 수 없는 프레임을 처리하는 방식입니다.
+type FramePolicy uint8
+
+// 프레임 처리 정책 정의
+const (
+	FrameReject FramePolicy = iota + 1 // 1 (연결을 끊음, 기본값)
+	FrameDrop                          // 2 (프레임을 버리고 다음 프레임을 계속 처리)
+	FramePass                          // 3 (프레임을 검사하지 않고 그대로 전달)
+)
+
+// frameHeaderSize는 타입(1 바이트)과 길이(4 바이트)로 이루어진 프레임 헤더의 크기입니다.
+const frameHeaderSize = 5
+
+// MaxFrameSize는 헤더를 포함한 프레임 하나의 최대 크기입니다. ScanFrames를 쓰는 Scanner의 버퍼 한도로 사용합니다.
+const MaxFrameSize = frameHeaderSize + int(MaxPayloadSize)
+
+// FrameFilter는 프레임 하나를 검사하는 함수입니다.
+// 수정한 Payload를 반환하면 그 값을 전달하고, nil을 반환하면 프레임을 버리며,
+// 에러를 반환하면 연결을 끊습니다.
+type FrameFilter func(dir Direction, payload Payload) (Payload, error)
+
+// FrameInspector는 프록시를 지나는 TLV 프레임을 decode로 해석하고 필터를 적용한 뒤 다시 인코딩합니다.
+type FrameInspector struct {
+	Filters []FrameFilter // 순서대로 적용할 필터 목록
+
+	MaxSize  uint32      // 허용할 최대 페이로드 크기 (0이거나 MaxPayloadSize보다 크면 MaxPayloadSize)
+	Oversize FramePolicy // MaxSize를 넘는 프레임의 처리 방식
+	Unknown  FramePolicy // 타입을 알 수 없는 프레임의 처리 방식
+}
+
+// maxSize는 실제로 적용할 최대 페이로드 크기를 반환합니다.
+func (f *FrameInspector) maxSize() uint32 {
+	if f.MaxSize == 0 || f.MaxSize > MaxPayloadSize {
+		return MaxPayloadSize // decode는 MaxPayloadSize보다 큰 프레임을 읽지 못함
+	}
+	return f.MaxSize
+}
+
+// copyFrames는 src에서 프레임을 하나씩 읽어 필터를 적용한 뒤 dst에 씁니다.
+// 종료 원인이 읽기 쪽(잘못된 프레임이나 필터의 거부 포함)인지 쓰기 쪽인지 구분해 반환합니다.
+func (f *FrameInspector) copyFrames(dst io.Writer, src io.Reader, dir Direction) (readErr, writeErr error) {
+	r := bufio.NewReader(src)
+	w := bufio.NewWriter(dst)
+
+	for {
+		header, err := r.Peek(frameHeaderSize)
+		if err != nil {
+			if err == io.EOF && len(header) == 0 {
+				return nil, nil // 프레임 경계에서 끝나면 정상 종료
+			}
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err, nil
+		}
+
+		// 헤더를 먼저 확인해 decode하지 않을 프레임을 골라냄
+		typ, size := header[0], binary.BigEndian.Uint32(header[1:])
+		var policy FramePolicy
+		var policyErr error
+		switch {
+		case typ != BinaryType && typ != StringType:
+			policy, policyErr = f.Unknown, ErrUnknownType
+		case size > f.maxSize():
+			policy, policyErr = f.Oversize, ErrMaxPayloadSize
+		}
+
+		if policyErr != nil {
+			frame := io.LimitReader(r, frameHeaderSize+int64(size))
+			switch policy {
+			case FrameDrop:
+				_, readErr = io.Copy(io.Discard, frame)
+			case FramePass:
+				readErr, writeErr = copyHalf(w, frame)
+				if writeErr == nil {
+					writeErr = w.Flush()
+				}
+			default:
+				readErr = policyErr
+			}
+			if readErr != nil || writeErr != nil {
+				return readErr, writeErr
+			}
+			continue
+		}
+
+		payload, err := decode(r)
+		if err != nil {
+			return err, nil
+		}
+
+		// 필터 체인 적용: nil을 반환한 필터가 있으면 프레임을 버림
+		for _, filter := range f.Filters {
+			if payload, err = filter(dir, payload); err != nil {
+				return err, nil
+			}
+			if payload == nil {
+				break
+			}
+		}
+		if payload == nil {
+			continue
+		}
+
+		// 다시 인코딩한 프레임을 한 번에 전송
+		if _, err := payload.WriteTo(w); err != nil {
+			return nil, err
+		}
+		if err := w.Flush(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// ScanFrames는 bufio.Scanner에서 TLV 프레임을 헤더를 포함한 토큰 하나로 나누는 bufio.SplitFunc입니다.
+// bufio.Scanner의 기본 버퍼보다 큰 프레임을 읽으려면 Scanner.Buffer로 최대 크기를 MaxFrameSize까지 늘려야 합니다.
+func ScanFrames(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if len(data) < frameHeaderSize {
+		if atEOF && len(data) > 0 {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+		return 0, nil, nil // 헤더를 모두 받을 때까지 기다림
+	}
+
+	size := binary.BigEndian.Uint32(data[1:frameHeaderSize])
+	if size > MaxPayloadSize {
+		return 0, nil, ErrMaxPayloadSize
+	}
+	n := frameHeaderSize + int(size)
+	if len(data) < n {
+		if atEOF {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+		return 0, nil, nil
+	}
+	return n, data[:n], nil
+}
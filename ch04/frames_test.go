@@ -0,0 +1,189 @@
+package ch04
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// errForbidden은 필터가 프레임을 거부할 때 사용하는 테스트용 에러입니다.
+var errForbidden = errors.New("forbidden payload")
+
+// TestProxyFrameFilters 함수는 필터 체인이 프레임을 수정, 버림, 거부할 수 있는지 테스트합니다.
+func TestProxyFrameFilters(t *testing.T) {
+	server := newPongServer(t) // 프레임을 그대로 에코하는 업스트림
+
+	upper := func(dir Direction, p Payload) (Payload, error) {
+		if s, ok := p.(*String); ok && dir == ClientToUpstream {
+			upper := String(strings.ToUpper(string(*s)))
+			return &upper, nil
+		}
+		return p, nil
+	}
+	dropBinary := func(_ Direction, p Payload) (Payload, error) {
+		if _, ok := p.(*Binary); ok {
+			return nil, nil
+		}
+		return p, nil
+	}
+	reject := func(_ Direction, p Payload) (Payload, error) {
+		if strings.Contains(p.String(), "PANIC") {
+			return nil, errForbidden
+		}
+		return p, nil
+	}
+
+	errs := make(chan error, 1)
+	addr := serveProxy(t, &Proxy{
+		Upstream: server.Addr().String(),
+		Frames:   &FrameInspector{Filters: []FrameFilter{upper, dropBinary, reject}},
+		OnClose:  func(_ net.Conn, _ CloseReason, err error) { errs <- err },
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	b := Binary("dropped")
+	s1 := String("errors are values.")
+	s2 := String("clear is better than clever.")
+	for _, p := range []Payload{&s1, &b, &s2} {
+		if _, err := p.WriteTo(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Binary 프레임은 버려지고 String 프레임은 대문자로 바뀌어 에코되어야 함
+	for _, expected := range []string{"ERRORS ARE VALUES.", "CLEAR IS BETTER THAN CLEVER."} {
+		actual, err := decode(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := String(expected); !reflect.DeepEqual(&e, actual) {
+			t.Errorf("expected %q; actual %q", expected, actual)
+		}
+	}
+
+	// 거부된 프레임은 연결을 끊음
+	s3 := String("don't panic.")
+	if _, err := s3.WriteTo(conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != errForbidden {
+		t.Errorf("expected %v; actual %v", errForbidden, err)
+	}
+}
+
+// rawFrame은 지정한 타입과 페이로드로 프레임 바이트를 만듭니다.
+func rawFrame(typ uint8, payload string) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(typ)
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(payload)))
+	buf.WriteString(payload)
+	return buf.Bytes()
+}
+
+// TestProxyFramePolicy 함수는 알 수 없는 타입과 최대 크기를 넘는 프레임이 정책에 따라 처리되는지 테스트합니다.
+func TestProxyFramePolicy(t *testing.T) {
+	const unknownType = 9
+
+	tests := []struct {
+		name     string
+		frames   *FrameInspector
+		input    []byte
+		expected []byte // nil이면 연결이 끊겨야 함
+	}{
+		{"unknown drop", &FrameInspector{Unknown: FrameDrop},
+			append(rawFrame(unknownType, "???"), rawFrame(StringType, "ok")...),
+			rawFrame(StringType, "ok")},
+		{"unknown pass", &FrameInspector{Unknown: FramePass},
+			append(rawFrame(unknownType, "???"), rawFrame(StringType, "ok")...),
+			append(rawFrame(unknownType, "???"), rawFrame(StringType, "ok")...)},
+		{"unknown reject", &FrameInspector{},
+			rawFrame(unknownType, "???"), nil},
+		{"oversize drop", &FrameInspector{MaxSize: 4, Oversize: FrameDrop},
+			append(rawFrame(BinaryType, "too large"), rawFrame(StringType, "ok")...),
+			rawFrame(StringType, "ok")},
+		{"oversize reject", &FrameInspector{MaxSize: 4},
+			rawFrame(BinaryType, "too large"), nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newPongServer(t)
+			addr := serveProxy(t, &Proxy{Upstream: server.Addr().String(), Frames: tc.frames})
+
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if _, err := conn.Write(tc.input); err != nil {
+				t.Fatal(err)
+			}
+
+			_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+			actual := make([]byte, 0, len(tc.expected))
+			buf := make([]byte, 64)
+			for len(actual) < len(tc.expected) || tc.expected == nil {
+				n, err := conn.Read(buf)
+				if err != nil {
+					if tc.expected != nil || isTimeout(err) {
+						t.Fatalf("expected %q; actual %q (%v)", tc.expected, actual, err)
+					}
+					return // 기대한 대로 연결이 끊김
+				}
+				actual = append(actual, buf[:n]...)
+			}
+			if !bytes.Equal(actual, tc.expected) {
+				t.Errorf("expected %q; actual %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+// TestScanFrames 함수는 bufio.Scanner가 조각나서 도착한 프레임을 프레임 단위로 나누는지 테스트합니다.
+func TestScanFrames(t *testing.T) {
+	var stream []byte
+	for _, p := range []io.WriterTo{String("ping"), Binary{0, 1, 2}, String("")} {
+		var buf bytes.Buffer
+		if _, err := p.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		stream = append(stream, buf.Bytes()...)
+	}
+
+	scanner := bufio.NewScanner(iotest.OneByteReader(bytes.NewReader(stream)))
+	scanner.Split(ScanFrames)
+	var frames [][]byte
+	for scanner.Scan() {
+		frames = append(frames, append([]byte(nil), scanner.Bytes()...))
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 3 || !bytes.Equal(frames[0], rawFrame(StringType, "ping")) ||
+		!bytes.Equal(frames[1], rawFrame(BinaryType, "\x00\x01\x02")) {
+		t.Errorf("unexpected frames: %q", frames)
+	}
+
+	// 프레임 중간에서 끝나면 에러
+	scanner = bufio.NewScanner(bytes.NewReader(stream[:7]))
+	scanner.Split(ScanFrames)
+	for scanner.Scan() {
+	}
+	if err := scanner.Err(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF; actual %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+//go:build linux
+
+package ch04
+
+import (
+	"net"
+	"syscall"
+)
+
+// PeerCredentials는 SO_PEERCRED 소켓 옵션으로 Unix 소켓 상대 프로세스의 자격 증명을 읽습니다.
+func PeerCredentials(conn net.Conn) (PeerCred, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return PeerCred{}, ErrNotUnixConn
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return PeerCred{}, err
+	}
+
+	var (
+		cred    *syscall.Ucred
+		credErr error
+	)
+	// 소켓의 파일 디스크립터에 직접 접근해 getsockopt 호출
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return PeerCred{}, err
+	}
+	if credErr != nil {
+		return PeerCred{}, credErr
+	}
+
+	return PeerCred{PID: cred.Pid, UID: cred.Uid, GID: cred.Gid}, nil
+}
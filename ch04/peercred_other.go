@@ -0,0 +1,13 @@
+//go:build !linux
+
+package ch04
+
+import "net"
+
+// PeerCredentials는 SO_PEERCRED를 지원하지 않는 플랫폼에서 항상 에러를 반환합니다.
+func PeerCredentials(conn net.Conn) (PeerCred, error) {
+	if _, ok := conn.(*net.UnixConn); !ok {
+		return PeerCred{}, ErrNotUnixConn
+	}
+	return PeerCred{}, ErrPeerCredUnsupported
+}
@@ -0,0 +1,301 @@
+package ch04
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// proxy 함수는 "from"에서 "to"로 데이터를 복사하며, 필요할 경우 역방향 프록시도 수행합니다.
+func proxy(from io.Reader, to io.Writer) error {
+	fromWriter, fromIsWriter := from.(io.Writer) // from이 io.Writer 인터페이스를 구현하는지 확인
+	toReader, toIsReader := to.(io.Reader)       // to가 io.Reader 인터페이스를 구현하는지 확인
+
+	if toIsReader && fromIsWriter {
+		// to가 io.Reader를 구현하고 from이 io.Writer를 구현하면
+		// 역방향으로 데이터를 복사하는 고루틴을 생성
+		go func() { _, _ = io.Copy(fromWriter, toReader) }()
+	}
+
+	// 기본적으로 "from"에서 "to"로 데이터를 복사
+	_, err := io.Copy(to, from)
+	return err
+}
+
+// Proxy는 리스너로 들어온 연결을 업스트림으로 전달하는 TCP 프록시입니다.
+// Connect가 false이면 모든 연결을 Upstream으로 그대로 전달하고,
+// true이면 클라이언트의 HTTP CONNECT 요청에 적힌 목적지로 터널을 엽니다.
+type Proxy struct {
+	Upstream  string      // raw 포워딩 시 연결을 전달할 주소 ("unix://" 접두사가 있으면 Unix 소켓)
+	Upstreams []string    // 설정되면 Upstream 대신 이 목록에서 라운드 로빈으로 업스트림을 선택
+	Connect   bool        // HTTP CONNECT 터널링 모드 사용 여부
+	Allow     []string    // CONNECT 모드에서 허용할 목적지 목록 (비어 있으면 모두 허용)
+	Dialer    *net.Dialer // 업스트림 연결에 사용할 Dialer (nil이면 기본값)
+
+	// ProxyHeader가 설정되면 업스트림 연결에 PROXY 프로토콜 헤더를 먼저 보내
+	// 업스트림 서버가 원래 클라이언트의 주소를 알 수 있게 함
+	ProxyHeader ProxyProtocol
+
+	TLSConfig   *tls.Config // 설정되면 클라이언트 연결의 TLS를 종료 (인증서 필요)
+	UpstreamTLS *tls.Config // 설정되면 업스트림 연결을 TLS로 다시 암호화
+
+	// HandshakeTimeout은 TLS 핸드셰이크와 CONNECT 요청을 기다리는 최대 시간 (0이면 defaultHandshakeTimeout)
+	HandshakeTimeout time.Duration
+
+	DialTimeout time.Duration // 업스트림 연결 타임아웃 (0이면 제한 없음)
+	IdleTimeout time.Duration // 양방향 모두 데이터가 없을 때 연결을 끊기까지의 시간 (0이면 제한 없음)
+	MaxLifetime time.Duration // 연결의 최대 수명 (0이면 제한 없음)
+
+	// Recorder가 설정되면 각 연결의 양방향 데이터를 캡처 파일로 기록
+	Recorder *Recorder
+
+	// Frames가 설정되면 바이트를 그대로 복사하지 않고 TLV 프레임 단위로 해석하고 필터링
+	Frames *FrameInspector
+
+	// Chaos가 설정되면 클라이언트 연결에 지연, 손상, 리셋 등의 장애를 주입
+	Chaos *Chaos
+
+	// Shaper가 설정되면 클라이언트 연결의 양방향 처리량을 제한
+	Shaper *TrafficShaper
+
+	// Splice가 true이면 두 연결이 모두 감싸지 않은 TCP 연결일 때 Linux에서 splice(2)로 데이터를 옮김
+	// 전달한 바이트 수는 spliceChunk 단위로 늦게 기록되며, 루프백 벤치마크에서는 기본 경로보다 느리므로
+	// 실제 환경에서 BenchmarkRelaySplice로 이득을 확인한 뒤에만 켬
+	Splice bool
+
+	MaxConns      int             // 최대 동시 연결 수 (0이면 제한 없음)
+	MaxConnsPerIP int             // 클라이언트 IP별 최대 동시 연결 수 (0이면 제한 없음)
+	WhenFull      AdmissionPolicy // 최대 동시 연결 수에 도달했을 때의 처리 방식
+	QueueTimeout  time.Duration   // AdmitQueue 정책에서 빈 자리를 기다리는 최대 시간 (0이면 무한정)
+	MaxQueue      int             // AdmitQueue 정책에서 동시에 기다릴 수 있는 최대 연결 수, 넘으면 바로 닫음 (0이면 defaultMaxQueue)
+
+	// ClientACL이 설정되면 클라이언트 주소를 검사하고,
+	// DestinationACL이 설정되면 이름 해석이 끝난 업스트림 주소를 연결 직전에 검사
+	ClientACL      *ACL
+	DestinationACL *ACL
+
+	// AuthSecret이 설정되면 클라이언트가 가장 먼저 보내는 TLV 프레임이 이 값과 일치해야 전달을 시작
+	AuthSecret  []byte
+	AuthTimeout time.Duration // 인증 프레임을 기다리는 최대 시간 (0이면 defaultAuthTimeout)
+
+	// OnDeny가 설정되면 접근 제어에 의해 거부된 연결마다 일치한 규칙과 함께 호출됨 (로그 기록 등에 사용)
+	OnDeny func(conn net.Conn, err *DenyError)
+
+	// AllowPeer가 설정되면 Unix 소켓으로 들어온 연결의 상대 프로세스 자격 증명(SO_PEERCRED)을 검사
+	// (자격 증명을 읽을 수 없는 TCP 연결 등은 거부)
+	AllowPeer func(cred PeerCred) bool
+
+	// OnClose가 설정되면 각 클라이언트 연결이 끝날 때 종료 이유와 함께 호출됨
+	OnClose func(conn net.Conn, reason CloseReason, err error)
+
+	stateOnce sync.Once
+	state     *proxyState   // 연결 수와 통계 (RouteManager는 설정을 바꿀 때 이전 프록시의 값을 넘겨줌)
+	next      atomic.Uint64 // Upstreams에서 다음에 선택할 순번
+}
+
+// proxyState는 연결 수 제한과 통계처럼 설정이 바뀌어도 이어서 유지해야 하는 프록시의 상태입니다.
+type proxyState struct {
+	admission admission
+	stats     proxyStats
+}
+
+// shared는 프록시의 상태를 반환하며, 처음 호출될 때 상태가 없으면 새로 만듭니다.
+func (p *Proxy) shared() *proxyState {
+	p.stateOnce.Do(func() {
+		if p.state == nil {
+			p.state = new(proxyState)
+		}
+	})
+	return p.state
+}
+
+// Serve는 리스너에서 연결을 수락하고 각 연결을 별도의 고루틴에서 처리합니다.
+// 연결 수 제한을 넘는 연결은 그 고루틴에서 바로 닫습니다.
+// 리스너가 닫히면 Accept 에러를 반환하며 종료합니다.
+func (p *Proxy) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept() // 클라이언트 연결 수락
+		if err != nil {
+			return err
+		}
+
+		p.serveConn(conn)
+	}
+}
+
+// serveConn은 새로운 고루틴에서 수락한 연결을 연결 수 제한에 따라 거부하거나 처리합니다.
+func (p *Proxy) serveConn(conn net.Conn) {
+	go func() {
+		ip, err := p.admit(conn)
+		if err != nil {
+			_ = conn.Close() // 제한을 넘은 연결은 바로 닫음
+			p.shared().stats.close(nil, CloseRejected, err)
+			if p.OnClose != nil {
+				p.OnClose(conn, CloseRejected, err)
+			}
+			return
+		}
+
+		defer p.release(ip)
+		p.handle(conn)
+	}()
+}
+
+// handle은 하나의 클라이언트 연결을 처리하고, 연결이 끝나면 종료 이유를 OnClose로 알립니다.
+func (p *Proxy) handle(conn net.Conn) {
+	defer conn.Close()
+
+	cs := p.shared().stats.open(conn)
+	reason, err := p.forward(conn, cs)
+	p.shared().stats.close(cs, reason, err)
+	if p.OnClose != nil {
+		p.OnClose(conn, reason, err)
+	}
+}
+
+// forward는 클라이언트 연결에 대한 업스트림을 결정하고 양방향으로 데이터를 전달하며, 전달한 바이트 수를 cs에 기록합니다.
+func (p *Proxy) forward(from net.Conn, cs *connStats) (CloseReason, error) {
+	var (
+		to  net.Conn
+		err error
+	)
+	if err = p.checkClient(from); err != nil {
+		return CloseRejected, err
+	}
+	if err = p.checkPeer(from); err != nil {
+		return CloseRejected, err
+	}
+
+	if p.TLSConfig != nil {
+		// 클라이언트와의 TLS를 종료하고, 이후에는 복호화된 연결을 사용
+		if from, err = p.serverTLS(from); err != nil {
+			return CloseRejected, err
+		}
+	}
+
+	if p.AuthSecret != nil {
+		// 공유 비밀을 담은 첫 프레임을 확인한 뒤에만 업스트림에 연결
+		if from, err = p.authenticate(from); err != nil {
+			return CloseRejected, err
+		}
+	}
+
+	if p.Connect {
+		// CONNECT 요청을 처리하고, 버퍼링된 데이터를 포함한 클라이언트 연결을 돌려받음
+		from, to, err = p.serveConnect(from)
+	} else {
+		network, address := splitNetwork(p.upstream())
+		to, err = p.dial(from, network, address)
+	}
+	if err != nil {
+		var (
+			dErr    *DialError
+			denyErr *DenyError
+		)
+		if errors.As(err, &denyErr) {
+			return CloseRejected, err // 접근 제어에 의해 거부된 목적지
+		}
+		if errors.As(err, &dErr) {
+			return CloseDialFailure, err // 업스트림 연결 실패
+		}
+		return CloseRejected, err // 잘못된 요청이거나 허용되지 않은 목적지
+	}
+	defer to.Close()
+	cs.setUpstream(to.RemoteAddr())
+
+	if p.Recorder != nil {
+		var done func()
+		from, done = p.Recorder.record(from)
+		defer done()
+	}
+
+	if p.Chaos != nil {
+		from = p.Chaos.wrap(from)
+	}
+
+	if p.Shaper != nil {
+		var release func()
+		from, release = p.Shaper.Shape(from)
+		defer release()
+	}
+
+	// 타임아웃을 적용하며 양방향 데이터 전달
+	return p.relay(from, to, cs)
+}
+
+// upstream은 raw 포워딩에 사용할 업스트림 주소를 반환합니다.
+// Upstreams가 설정되어 있으면 연결마다 목록의 다음 주소를 차례로 선택합니다.
+func (p *Proxy) upstream() string {
+	if len(p.Upstreams) == 0 {
+		return p.Upstream
+	}
+	n := p.next.Add(1) - 1
+	return p.Upstreams[n%uint64(len(p.Upstreams))]
+}
+
+// DialError는 업스트림 연결 실패를 나타냅니다.
+type DialError struct {
+	Address string // 연결하려던 업스트림 주소
+	Err     error  // 원래의 연결 에러
+}
+
+func (e *DialError) Error() string { return "dial " + e.Address + ": " + e.Err.Error() }
+
+// Unwrap은 원래의 연결 에러를 반환합니다.
+func (e *DialError) Unwrap() error { return e.Err }
+
+// dial은 설정된 Dialer로 업스트림에 연결을 생성합니다.
+// DialTimeout이 설정되어 있으면 그 시간 안에 연결되지 않을 때 타임아웃 에러를 반환합니다.
+// 연결 후에는 설정에 따라 client의 주소를 담은 PROXY 프로토콜 헤더를 보내고 TLS 핸드셰이크를 수행합니다.
+func (p *Proxy) dial(client net.Conn, network, address string) (net.Conn, error) {
+	d := p.Dialer
+	if d == nil {
+		d = new(net.Dialer)
+	}
+	if p.DestinationACL != nil {
+		// 호출자의 Dialer를 수정하지 않도록 복사본에 검사 함수를 설정
+		checked := *d
+		checked.Control = p.destinationControl(client, d.Control)
+		d = &checked
+	}
+
+	ctx := context.Background()
+	if p.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.DialTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, &DialError{Address: address, Err: err}
+	}
+	p.shared().stats.observeDial(time.Since(start))
+
+	if p.ProxyHeader != 0 {
+		// 클라이언트 주소와 클라이언트가 접속한 프록시 주소를 헤더로 전달
+		// PROXY 헤더는 TLS보다 먼저 평문으로 보내야 함
+		err = WriteProxyHeader(conn, p.ProxyHeader, client.RemoteAddr(), client.LocalAddr())
+		if err != nil {
+			_ = conn.Close()
+			return nil, &DialError{Address: address, Err: err}
+		}
+	}
+
+	if p.UpstreamTLS != nil {
+		tlsConn, err := p.clientTLS(conn, address)
+		if err != nil {
+			_ = conn.Close()
+			return nil, &DialError{Address: address, Err: err}
+		}
+		conn = tlsConn
+	}
+
+	return conn, nil
+}
@@ -5,17 +5,20 @@ import (
 	"net" // 네트워크 관련 기능을 제공하는 패키지
 )
 
-// proxyConn 함수는 소스와 목적지 주소를 받아서 TCP 연결을 설정하고 데이터를 전달하는 역할을 합니다.
+// proxyConn 함수는 소스와 목적지 주소를 받아서 연결을 설정하고 데이터를 전달하는 역할을 합니다.
+// 주소에 "unix://" 접두사가 있으면 Unix 도메인 소켓으로, 없으면 TCP로 연결합니다.
 func proxyConn(source, destination string) error {
-	// 소스 주소로 TCP 연결을 생성
-	connSource, err := net.Dial("tcp", source)
+	// 소스 주소로 연결을 생성
+	network, address := splitNetwork(source)
+	connSource, err := net.Dial(network, address)
 	if err != nil {
 		return err // 연결 실패 시 에러 반환
 	}
 	defer connSource.Close() // 함수 종료 시 소스 연결 닫기
 
-	// 목적지 주소로 TCP 연결을 생성
-	connDest, err := net.Dial("tcp", destination)
+	// 목적지 주소로 연결을 생성
+	network, address = splitNetwork(destination)
+	connDest, err := net.Dial(network, address)
 	if err != nil {
 		return err // 연결 실패 시 에러 반환
 	}
@@ -0,0 +1,317 @@
+package ch04
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProxyProtocol은 HAProxy PROXY 프로토콜 헤더의 버전을 나타냅니다.
+type ProxyProtocol uint8
+
+// PROXY 프로토콜 버전 정의
+const (
+	ProxyProtocolV1 ProxyProtocol = iota + 1 // 1 (텍스트 헤더)
+	ProxyProtocolV2                          // 2 (바이너리 헤더)
+
+	maxProxyHeaderV1 = 107 // v1 헤더의 최대 길이 (CRLF 포함)
+
+	defaultProxyHeaderTimeout = 5 * time.Second // 헤더를 읽을 때 적용할 기본 타임아웃
+)
+
+// v1 헤더의 시작 문자열
+const proxyHeaderV1Prefix = "PROXY "
+
+// v2 헤더의 12바이트 시그니처
+var proxyHeaderV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// PROXY 프로토콜 에러 정의
+var (
+	ErrNoProxyHeader        = errors.New("no PROXY protocol header")      // 헤더가 없는 연결
+	ErrInvalidProxyHeader   = errors.New("invalid PROXY protocol header") // 형식이 잘못된 헤더
+	ErrUnknownProxyProtocol = errors.New("unknown PROXY protocol version")
+)
+
+// WriteProxyHeader는 src에서 dst로 향하는 연결을 설명하는 PROXY 프로토콜 헤더를 w에 작성합니다.
+// TCP 또는 UDP 주소가 아니면 주소 정보가 없는 헤더(UNKNOWN/UNSPEC)를 작성합니다.
+func WriteProxyHeader(w io.Writer, version ProxyProtocol, src, dst net.Addr) error {
+	var header []byte
+
+	switch version {
+	case ProxyProtocolV1:
+		header = proxyHeaderV1(src, dst)
+	case ProxyProtocolV2:
+		header = proxyHeaderV2(src, dst)
+	default:
+		return ErrUnknownProxyProtocol
+	}
+
+	_, err := w.Write(header)
+	return err
+}
+
+// proxyHeaderV1은 "PROXY TCP4 <src> <dst> <sport> <dport>\r\n" 형태의 텍스트 헤더를 만듭니다.
+func proxyHeaderV1(src, dst net.Addr) []byte {
+	srcIP, srcPort, srcOK := addrIPPort(src)
+	dstIP, dstPort, dstOK := addrIPPort(dst)
+	_, isTCP := src.(*net.TCPAddr)
+	if !srcOK || !dstOK || !isTCP {
+		return []byte("PROXY UNKNOWN\r\n") // v1은 TCP만 표현 가능
+	}
+
+	family := "TCP4"
+	if srcIP.To4() == nil || dstIP.To4() == nil {
+		family = "TCP6"
+		srcIP, dstIP = srcIP.To16(), dstIP.To16()
+	} else {
+		srcIP, dstIP = srcIP.To4(), dstIP.To4()
+	}
+
+	return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n",
+		family, srcIP, dstIP, srcPort, dstPort))
+}
+
+// proxyHeaderV2는 시그니처, 버전/명령, 주소 체계, 길이, 주소 블록으로 이루어진 바이너리 헤더를 만듭니다.
+func proxyHeaderV2(src, dst net.Addr) []byte {
+	buf := new(bytes.Buffer)
+	buf.Write(proxyHeaderV2Signature)
+	buf.WriteByte(0x21) // 버전 2, PROXY 명령
+
+	srcIP, srcPort, srcOK := addrIPPort(src)
+	dstIP, dstPort, dstOK := addrIPPort(dst)
+	if !srcOK || !dstOK {
+		buf.WriteByte(0x00)                                // AF_UNSPEC
+		_ = binary.Write(buf, binary.BigEndian, uint16(0)) // 주소 블록 없음
+		return buf.Bytes()
+	}
+
+	// 하위 4비트는 전송 프로토콜: 1 (STREAM), 2 (DGRAM)
+	var proto byte = 0x01
+	if _, isUDP := src.(*net.UDPAddr); isUDP {
+		proto = 0x02
+	}
+
+	if src4, dst4 := srcIP.To4(), dstIP.To4(); src4 != nil && dst4 != nil {
+		buf.WriteByte(0x10 | proto) // AF_INET
+		_ = binary.Write(buf, binary.BigEndian, uint16(12))
+		buf.Write(src4)
+		buf.Write(dst4)
+	} else {
+		buf.WriteByte(0x20 | proto) // AF_INET6
+		_ = binary.Write(buf, binary.BigEndian, uint16(36))
+		buf.Write(srcIP.To16())
+		buf.Write(dstIP.To16())
+	}
+	_ = binary.Write(buf, binary.BigEndian, uint16(srcPort))
+	_ = binary.Write(buf, binary.BigEndian, uint16(dstPort))
+
+	return buf.Bytes()
+}
+
+// addrIPPort는 TCP 또는 UDP 주소에서 IP와 포트를 꺼냅니다.
+func addrIPPort(addr net.Addr) (net.IP, int, bool) {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP, a.Port, a.IP != nil
+	case *net.UDPAddr:
+		return a.IP, a.Port, a.IP != nil
+	default:
+		return nil, 0, false
+	}
+}
+
+// ReadProxyHeader는 r에서 v1 또는 v2 PROXY 프로토콜 헤더를 읽어 원래의 출발지와 목적지 주소를 반환합니다.
+// 헤더가 주소 정보를 담고 있지 않으면(UNKNOWN, LOCAL 등) nil 주소와 nil 에러를 반환합니다.
+func ReadProxyHeader(r *bufio.Reader) (src, dst net.Addr, err error) {
+	// 가장 짧은 v1 헤더("PROXY UNKNOWN\r\n")도 v2 시그니처보다 길므로 시그니처 길이만큼 확인
+	prefix, err := r.Peek(len(proxyHeaderV2Signature))
+	switch {
+	case bytes.HasPrefix(prefix, []byte(proxyHeaderV1Prefix)):
+		return readProxyHeaderV1(r)
+	case bytes.Equal(prefix, proxyHeaderV2Signature):
+		return readProxyHeaderV2(r)
+	case err != nil && (bytes.HasPrefix([]byte(proxyHeaderV1Prefix), prefix) || bytes.HasPrefix(proxyHeaderV2Signature, prefix)):
+		if err == io.EOF && len(prefix) > 0 {
+			err = io.ErrUnexpectedEOF // 헤더의 앞부분만 받고 끝남
+		}
+		return nil, nil, err
+	}
+
+	return nil, nil, ErrNoProxyHeader // 헤더보다 짧은 스트림도 헤더와 다르면 헤더가 없는 연결
+}
+
+// readProxyHeaderV1은 CRLF로 끝나는 텍스트 헤더를 읽고 해석합니다.
+func readProxyHeaderV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	line := make([]byte, 0, maxProxyHeaderV1)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) == maxProxyHeaderV1 {
+			return nil, nil, ErrInvalidProxyHeader // 최대 길이를 넘으면 잘못된 헤더
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil // 주소 정보 없음
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, ErrInvalidProxyHeader
+	}
+
+	src, err := parseTCPAddr(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := parseTCPAddr(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return src, dst, nil
+}
+
+// parseTCPAddr는 텍스트 IP와 포트를 *net.TCPAddr로 변환합니다.
+func parseTCPAddr(host, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	p, err := strconv.ParseUint(port, 10, 16)
+	if ip == nil || err != nil {
+		return nil, ErrInvalidProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// readProxyHeaderV2는 16바이트 고정 헤더와 그 뒤의 주소 블록을 읽고 해석합니다.
+// 주소 블록 뒤에 붙은 TLV 확장은 읽고 버립니다.
+func readProxyHeaderV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+
+	verCmd, family := header[12], header[13]
+	if verCmd>>4 != 2 {
+		return nil, nil, ErrInvalidProxyHeader // 버전 2가 아니면 잘못된 헤더
+	}
+
+	body := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, nil, err
+	}
+
+	if verCmd&0x0f == 0x00 {
+		return nil, nil, nil // LOCAL 명령: 프록시 자신의 연결 (헬스 체크 등)
+	}
+
+	var ipLen int
+	switch family >> 4 {
+	case 0x1: // AF_INET
+		ipLen = net.IPv4len
+	case 0x2: // AF_INET6
+		ipLen = net.IPv6len
+	default:
+		return nil, nil, nil // AF_UNSPEC, AF_UNIX는 주소를 복원하지 않음
+	}
+	if len(body) < 2*ipLen+4 {
+		return nil, nil, ErrInvalidProxyHeader
+	}
+
+	srcIP := net.IP(body[:ipLen])
+	dstIP := net.IP(body[ipLen : 2*ipLen])
+	srcPort := int(binary.BigEndian.Uint16(body[2*ipLen:]))
+	dstPort := int(binary.BigEndian.Uint16(body[2*ipLen+2:]))
+
+	if family&0x0f == 0x02 { // DGRAM
+		return &net.UDPAddr{IP: srcIP, Port: srcPort}, &net.UDPAddr{IP: dstIP, Port: dstPort}, nil
+	}
+	return &net.TCPAddr{IP: srcIP, Port: srcPort}, &net.TCPAddr{IP: dstIP, Port: dstPort}, nil
+}
+
+// ProxyProtocolListener는 수락한 연결에서 PROXY 프로토콜 헤더를 읽어
+// RemoteAddr와 LocalAddr가 원래 클라이언트의 주소를 반환하도록 만드는 리스너입니다.
+// 헤더는 Accept가 아니라 연결을 처음 사용할 때 읽으므로 느린 클라이언트가 Accept를 막지 않습니다.
+type ProxyProtocolListener struct {
+	net.Listener
+	HeaderTimeout time.Duration // 헤더를 읽을 때 적용할 타임아웃 (0이면 defaultProxyHeaderTimeout)
+}
+
+// Accept는 다음 연결을 수락하고 PROXY 프로토콜 헤더를 해석하는 연결로 감싸 반환합니다.
+func (l *ProxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := l.HeaderTimeout
+	if timeout <= 0 {
+		timeout = defaultProxyHeaderTimeout
+	}
+
+	return &proxyProtocolConn{
+		Conn:    conn,
+		r:       bufio.NewReader(conn),
+		timeout: timeout,
+	}, nil
+}
+
+// proxyProtocolConn은 처음 사용될 때 PROXY 프로토콜 헤더를 한 번만 읽는 net.Conn입니다.
+type proxyProtocolConn struct {
+	net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+
+	once     sync.Once
+	src, dst net.Addr
+	err      error
+}
+
+// readHeader는 헤더를 한 번만 읽고 결과를 저장합니다.
+// 헤더를 읽는 동안 타임아웃을 적용하고, 읽은 뒤 읽기 데드라인을 해제합니다.
+func (c *proxyProtocolConn) readHeader() {
+	c.once.Do(func() {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		defer func() { _ = c.Conn.SetReadDeadline(time.Time{}) }()
+		c.src, c.dst, c.err = ReadProxyHeader(c.r)
+	})
+}
+
+// NetConn은 감싼 연결을 반환합니다.
+func (c *proxyProtocolConn) NetConn() net.Conn { return c.Conn }
+
+// Read는 헤더 이후의 데이터를 읽습니다. 헤더가 잘못되었으면 그 에러를 반환합니다.
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr는 헤더에 담긴 원래 클라이언트 주소를 반환합니다.
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.src != nil {
+		return c.src
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr는 헤더에 담긴 원래 목적지 주소를 반환합니다.
+func (c *proxyProtocolConn) LocalAddr() net.Addr {
+	c.readHeader()
+	if c.dst != nil {
+		return c.dst
+	}
+	return c.Conn.LocalAddr()
+}
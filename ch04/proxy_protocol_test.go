@@ -0,0 +1,120 @@
+package ch04
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+// TestProxyHeader 함수는 v1, v2 헤더를 작성하고 다시 읽었을 때 주소가 그대로 복원되는지 테스트합니다.
+func TestProxyHeader(t *testing.T) {
+	tests := []struct {
+		version  ProxyProtocol
+		src, dst net.Addr
+	}{
+		{ProxyProtocolV1,
+			&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 51234},
+			&net.TCPAddr{IP: net.ParseIP("198.51.100.7"), Port: 443}},
+		{ProxyProtocolV1,
+			&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 51234},
+			&net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 80}},
+		{ProxyProtocolV2,
+			&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 51234},
+			&net.TCPAddr{IP: net.ParseIP("198.51.100.7"), Port: 443}},
+		{ProxyProtocolV2,
+			&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 51234},
+			&net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 80}},
+		{ProxyProtocolV2,
+			&net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 5353},
+			&net.UDPAddr{IP: net.ParseIP("198.51.100.7"), Port: 53}},
+	}
+
+	for i, tc := range tests {
+		buf := new(bytes.Buffer)
+		if err := WriteProxyHeader(buf, tc.version, tc.src, tc.dst); err != nil {
+			t.Fatal(err)
+		}
+		buf.WriteString("payload") // 헤더 뒤의 데이터는 그대로 남아 있어야 함
+
+		r := bufio.NewReader(buf)
+		src, dst, err := ReadProxyHeader(r)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if src.String() != tc.src.String() || dst.String() != tc.dst.String() {
+			t.Errorf("%d: expected %s -> %s; actual %s -> %s", i, tc.src, tc.dst, src, dst)
+		}
+
+		rest := make([]byte, 16)
+		n, _ := r.Read(rest)
+		if actual := string(rest[:n]); actual != "payload" {
+			t.Errorf("%d: expected remaining %q; actual %q", i, "payload", actual)
+		}
+	}
+}
+
+// TestProxyHeaderInvalid 함수는 헤더가 없거나 잘못된 경우 에러를 반환하는지 테스트합니다.
+func TestProxyHeaderInvalid(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected error
+	}{
+		{"GET / HTTP/1.1\r\n\r\n", ErrNoProxyHeader},
+		{"PROXY TCP4 192.0.2.1\r\n", ErrInvalidProxyHeader},
+		{"PROXY TCP4 192.0.2.1 198.51.100.7 99999 80\r\n", ErrInvalidProxyHeader},
+		{"PROXY UNKNOWN\r\n", nil},
+		{"ping", ErrNoProxyHeader},            // 헤더보다 짧아도 헤더가 아니면 ErrNoProxyHeader
+		{"PROXY", io.ErrUnexpectedEOF},        // 헤더의 앞부분에서 끝남
+		{"\r\n\r\n\x00", io.ErrUnexpectedEOF}, // v2 시그니처의 앞부분에서 끝남
+		{"", io.EOF},
+	}
+
+	for i, tc := range tests {
+		_, _, err := ReadProxyHeader(bufio.NewReader(bytes.NewBufferString(tc.input)))
+		if err != tc.expected {
+			t.Errorf("%d: expected %v; actual %v", i, tc.expected, err)
+		}
+	}
+}
+
+// TestProxyProtocolListener 함수는 프록시가 보낸 헤더로 서버가 원래 클라이언트의 주소를 복원하는지 테스트합니다.
+func TestProxyProtocolListener(t *testing.T) {
+	for _, version := range []ProxyProtocol{ProxyProtocolV1, ProxyProtocolV2} {
+		listener, err := net.Listen("tcp", "127.0.0.1:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := &ProxyProtocolListener{Listener: listener}
+
+		// 서버는 복원된 클라이언트 주소를 응답으로 보냄
+		go func() {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			_, _ = conn.Write([]byte(conn.RemoteAddr().String()))
+		}()
+
+		addr := serveProxy(t, &Proxy{Upstream: listener.Addr().String(), ProxyHeader: version})
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf := make([]byte, 64)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual, expected := string(buf[:n]), conn.LocalAddr().String(); actual != expected {
+			t.Errorf("v%d: expected remote address %q; actual %q", version, expected, actual)
+		}
+
+		_ = conn.Close()
+		_ = server.Close()
+	}
+}
@@ -7,22 +7,6 @@ import (
 	"testing"
 )
 
-// proxy 함수는 "from"에서 "to"로 데이터를 복사하며, 필요할 경우 역방향 프록시도 수행합니다.
-func proxy(from io.Reader, to io.Writer) error {
-	fromWriter, fromIsWriter := from.(io.Writer) // from이 io.Writer 인터페이스를 구현하는지 확인
-	toReader, toIsReader := to.(io.Reader)       // to가 io.Reader 인터페이스를 구현하는지 확인
-
-	if toIsReader && fromIsWriter {
-		// to가 io.Reader를 구현하고 from이 io.Writer를 구현하면
-		// 역방향으로 데이터를 복사하는 고루틴을 생성
-		go func() { _, _ = io.Copy(fromWriter, toReader) }()
-	}
-
-	// 기본적으로 "from"에서 "to"로 데이터를 복사
-	_, err := io.Copy(to, from)
-	return err
-}
-
 // TestProxy 함수는 프록시 서버가 정상적으로 작동하는지 테스트합니다.
 func TestProxy(t *testing.T) {
 	var wg sync.WaitGroup // 고루틴 동기화를 위한 WaitGroup
@@ -149,3 +133,85 @@ func TestProxy(t *testing.T) {
 	_ = server.Close()
 	wg.Wait() // 모든 고루틴이 완료될 때까지 대기
 }
+
+// newPongServer는 "ping" 메시지에 "pong"으로 응답하고 그 외의 메시지는 에코하는
+// 테스트용 TCP 서버를 시작합니다. 테스트가 끝나면 리스너를 닫습니다.
+func newPongServer(t *testing.T) net.Listener {
+	t.Helper()
+
+	server, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+
+	servePong(server)
+	return server
+}
+
+// servePong은 리스너에서 연결을 수락하고 각 연결에 ping/pong 에코 응답을 보냅니다.
+func servePong(server net.Listener) {
+	go func() {
+		for {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(c net.Conn) {
+				defer c.Close()
+
+				buf := make([]byte, 1024)
+				for {
+					n, err := c.Read(buf)
+					if err != nil {
+						return
+					}
+
+					switch msg := string(buf[:n]); msg {
+					case "ping":
+						_, err = c.Write([]byte("pong"))
+					default:
+						_, err = c.Write(buf[:n])
+					}
+					if err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+}
+
+// pingPong은 conn으로 "ping"을 보내고 "pong" 응답을 받는지 확인합니다.
+func pingPong(t *testing.T, conn net.Conn) {
+	t.Helper()
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := string(buf[:n]); actual != "pong" {
+		t.Fatalf("expected reply: %q; actual: %q", "pong", actual)
+	}
+}
+
+// serveProxy는 임의의 포트에서 p를 실행하고 프록시의 주소를 반환합니다.
+func serveProxy(t *testing.T, p *Proxy) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() { _ = p.Serve(listener) }()
+
+	return listener.Addr().String()
+}
@@ -0,0 +1,325 @@
+package ch04
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// minBurst는 토큰 버킷에 쌓일 수 있는 최소 바이트 수입니다.
+const minBurst = 1024
+
+// RateLimiter는 초당 바이트 수를 제한하는 토큰 버킷입니다.
+// 버킷에는 최대 0.1초 분량의 토큰이 쌓이며, 속도가 0이면 제한하지 않습니다.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64   // 초당 채워지는 토큰(바이트) 수
+	burst  float64   // 버킷의 최대 토큰 수
+	tokens float64   // 현재 토큰 수 (예약으로 인해 음수가 될 수 있음)
+	last   time.Time // 마지막으로 토큰을 채운 시각
+}
+
+// NewRateLimiter는 초당 bytesPerSecond 바이트를 허용하는 RateLimiter를 생성합니다.
+func NewRateLimiter(bytesPerSecond int) *RateLimiter {
+	l := new(RateLimiter)
+	l.SetRate(bytesPerSecond)
+	l.tokens = l.burst // 처음에는 버킷이 가득 찬 상태로 시작
+	return l
+}
+
+// SetRate는 초당 허용 바이트 수를 변경합니다. 이미 대기 중인 연결에도 다음 예약부터 적용됩니다.
+func (l *RateLimiter) SetRate(bytesPerSecond int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now()) // 이전 속도로 쌓인 토큰을 먼저 반영
+	l.rate = float64(bytesPerSecond)
+	l.burst = l.rate / 10
+	if l.burst < minBurst {
+		l.burst = minBurst
+	}
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// Rate는 현재 초당 허용 바이트 수를 반환합니다.
+func (l *RateLimiter) Rate() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.rate)
+}
+
+// refill은 마지막 시각 이후 흐른 시간만큼 토큰을 채웁니다. 호출자가 잠금을 가지고 있어야 합니다.
+func (l *RateLimiter) refill(now time.Time) {
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
+
+// take는 모든 limiter에 n개의 토큰이 있으면 한꺼번에 가져가고 0을 반환합니다.
+// 하나라도 부족하면 어느 limiter에서도 가져가지 않고, 가장 부족한 limiter(병목)에 토큰이 채워질 때까지의 시간을 반환합니다.
+// 버킷보다 큰 n은 버킷이 가득 차면 가져가며, 모자란 만큼은 다음 전송을 늦춥니다.
+// 잠금 순서가 항상 같도록 호출자는 limiter를 같은 순서(연결, IP, 전체)로 전달해야 합니다.
+func take(n int, limiters ...*RateLimiter) time.Duration {
+	now := time.Now()
+	var (
+		delay  time.Duration
+		active []*RateLimiter
+	)
+	for _, l := range limiters {
+		if l == nil {
+			continue
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.rate <= 0 {
+			continue // 제한 없음
+		}
+
+		l.refill(now)
+		active = append(active, l)
+		if need := min(float64(n), l.burst); l.tokens < need {
+			if d := time.Duration((need - l.tokens) / l.rate * float64(time.Second)); d > delay {
+				delay = max(d, time.Millisecond)
+			}
+		}
+	}
+	if delay > 0 {
+		return delay
+	}
+
+	for _, l := range active {
+		l.tokens -= float64(n)
+	}
+	return 0
+}
+
+// chunk는 한 번에 읽거나 쓸 최대 바이트 수를 반환합니다. 제한이 없으면 0을 반환합니다.
+func (l *RateLimiter) chunk() int {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate <= 0 {
+		return 0
+	}
+	return int(l.burst)
+}
+
+// Wait는 n 바이트를 전송할 수 있을 때까지 대기합니다.
+func (l *RateLimiter) Wait(n int) { _ = waitAll(n, nil, time.Time{}, l) }
+
+// waitAll은 모든 limiter에서 n개의 토큰을 가져올 수 있을 때까지 기다린 뒤 가져갑니다.
+// 토큰은 병목인 limiter가 채워진 뒤 한꺼번에 가져가므로, 기다리는 동안 다른 limiter의 토큰을 묶어 두지 않습니다.
+// done이 닫히면 net.ErrClosed를, deadline이 지나면 os.ErrDeadlineExceeded를 반환합니다.
+func waitAll(n int, done <-chan struct{}, deadline time.Time, limiters ...*RateLimiter) error {
+	for {
+		delay := take(n, limiters...)
+		if delay == 0 {
+			return nil
+		}
+
+		if !deadline.IsZero() {
+			until := time.Until(deadline)
+			if until <= 0 {
+				return os.ErrDeadlineExceeded
+			}
+			delay = min(delay, until)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-done:
+			timer.Stop()
+			return net.ErrClosed
+		case <-timer.C:
+		}
+	}
+}
+
+// TrafficShaper는 연결별, 클라이언트 IP별, 전체 대역폭 제한을 관리합니다.
+// 각 제한은 한 연결의 두 방향을 합한 초당 바이트 수이며, 0이면 제한하지 않습니다.
+// SetLimits로 변경한 제한은 기존 연결을 끊지 않고 바로 적용됩니다.
+type TrafficShaper struct {
+	mu      sync.Mutex
+	perConn int
+	perIP   int
+	global  *RateLimiter
+	conns   map[*RateLimiter]struct{} // 활성 연결별 limiter
+	ips     map[string]*ipLimiter     // 클라이언트 IP별 limiter
+}
+
+// ipLimiter는 같은 IP의 연결들이 공유하는 limiter와 참조 수입니다.
+type ipLimiter struct {
+	limiter *RateLimiter
+	refs    int
+}
+
+// NewTrafficShaper는 주어진 제한(초당 바이트 수)으로 TrafficShaper를 생성합니다.
+func NewTrafficShaper(perConn, perIP, global int) *TrafficShaper {
+	return &TrafficShaper{
+		perConn: perConn,
+		perIP:   perIP,
+		global:  NewRateLimiter(global),
+		conns:   make(map[*RateLimiter]struct{}),
+		ips:     make(map[string]*ipLimiter),
+	}
+}
+
+// SetLimits는 제한을 변경하고 모든 활성 연결에 즉시 적용합니다.
+func (s *TrafficShaper) SetLimits(perConn, perIP, global int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.perConn, s.perIP = perConn, perIP
+	s.global.SetRate(global)
+	for l := range s.conns {
+		l.SetRate(perConn)
+	}
+	for _, ip := range s.ips {
+		ip.limiter.SetRate(perIP)
+	}
+}
+
+// Shape는 conn의 읽기와 쓰기를 제한하는 연결과, 연결이 끝났을 때 호출할 해제 함수를 반환합니다.
+func (s *TrafficShaper) Shape(conn net.Conn) (net.Conn, func()) {
+	ip := hostOf(conn.RemoteAddr())
+
+	s.mu.Lock()
+	perConn := NewRateLimiter(s.perConn)
+	s.conns[perConn] = struct{}{}
+
+	perIP, ok := s.ips[ip]
+	if !ok {
+		perIP = &ipLimiter{limiter: NewRateLimiter(s.perIP)}
+		s.ips[ip] = perIP
+	}
+	perIP.refs++
+	s.mu.Unlock()
+
+	release := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.conns, perConn)
+		if perIP.refs--; perIP.refs == 0 {
+			delete(s.ips, ip) // 마지막 연결이 끝나면 IP별 limiter 정리
+		}
+	}
+
+	return &shapedConn{
+		Conn:     conn,
+		limiters: []*RateLimiter{perConn, perIP.limiter, s.global},
+		closed:   make(chan struct{}),
+	}, release
+}
+
+// shapedConn은 읽기와 쓰기를 여러 RateLimiter로 제한하는 net.Conn입니다.
+// 토큰을 기다리는 중에도 Close와 데드라인으로 대기를 중단할 수 있습니다.
+type shapedConn struct {
+	net.Conn
+	limiters []*RateLimiter
+
+	closeOnce sync.Once
+	closed    chan struct{} // Close하면 닫혀 대기 중인 읽기와 쓰기를 깨움
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// Close는 대기 중인 읽기와 쓰기를 깨우고 연결을 닫습니다.
+func (c *shapedConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// SetDeadline은 읽기와 쓰기 데드라인을 설정하며, 토큰 대기에도 적용합니다.
+func (c *shapedConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline, c.writeDeadline = t, t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline은 읽기 데드라인을 설정하며, 읽은 뒤의 토큰 대기에도 적용합니다.
+func (c *shapedConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline은 쓰기 데드라인을 설정하며, 쓰기 전의 토큰 대기에도 적용합니다.
+func (c *shapedConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// deadlines는 현재 읽기와 쓰기 데드라인을 반환합니다.
+func (c *shapedConn) deadlines() (read, write time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readDeadline, c.writeDeadline
+}
+
+// chunk는 limiter들 중 가장 작은 버킷 크기를 반환합니다. 제한이 없으면 0을 반환합니다.
+func (c *shapedConn) chunk() int {
+	size := 0
+	for _, l := range c.limiters {
+		if n := l.chunk(); n > 0 && (size == 0 || n < size) {
+			size = n
+		}
+	}
+	return size
+}
+
+// Read는 버킷 크기만큼만 읽고, 읽은 바이트 수만큼 토큰이 쌓일 때까지 대기합니다.
+func (c *shapedConn) Read(b []byte) (int, error) {
+	if size := c.chunk(); size > 0 && len(b) > size {
+		b = b[:size]
+	}
+
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		deadline, _ := c.deadlines()
+		if wErr := waitAll(n, c.closed, deadline, c.limiters...); wErr != nil && err == nil {
+			err = wErr // 이미 읽은 데이터는 반환하고, 대기가 중단된 원인을 함께 알림
+		}
+	}
+	return n, err
+}
+
+// Write는 데이터를 버킷 크기 단위로 나누어, 토큰을 확보한 뒤 씁니다.
+func (c *shapedConn) Write(b []byte) (int, error) {
+	var written int
+	for len(b) > 0 {
+		part := b
+		if size := c.chunk(); size > 0 && len(part) > size {
+			part = part[:size]
+		}
+
+		_, deadline := c.deadlines()
+		if err := waitAll(len(part), c.closed, deadline, c.limiters...); err != nil {
+			return written, err
+		}
+		n, err := c.Conn.Write(part)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
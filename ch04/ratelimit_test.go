@@ -0,0 +1,176 @@
+package ch04
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRateLimiter 함수는 토큰이 부족할 때 부족한 바이트 수에 비례해 대기 시간을 계산하는지 테스트합니다.
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(10 << 10) // 10KB/s, 버킷 크기 1KB
+
+	if d := take(1<<10, l); d != 0 {
+		t.Errorf("expected no delay for burst; actual %v", d)
+	}
+
+	// 버킷이 비어 있으므로 1KB를 더 보내려면 약 0.1초를 기다려야 함
+	if d := take(1<<10, l); d < 90*time.Millisecond || d > 110*time.Millisecond {
+		t.Errorf("expected delay of about 100ms; actual %v", d)
+	}
+
+	// 속도가 0이면 제한하지 않음
+	l.SetRate(0)
+	if d := take(1<<20, l); d != 0 {
+		t.Errorf("expected no delay when unlimited; actual %v", d)
+	}
+}
+
+// TestRateLimiterBottleneck 함수는 병목이 아닌 limiter의 토큰을 기다리는 동안 가져가지 않는지 테스트합니다.
+func TestRateLimiterBottleneck(t *testing.T) {
+	fast := NewRateLimiter(10 << 20) // 10MB/s, 버킷 크기 1MB
+	slow := NewRateLimiter(10 << 10) // 10KB/s, 버킷 크기 1KB
+	tokens := func(l *RateLimiter) float64 {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.tokens
+	}
+
+	if d := take(1<<10, fast, slow); d != 0 {
+		t.Fatalf("expected no delay for burst; actual %v", d)
+	}
+	before := tokens(fast)
+	if d := take(1<<10, fast, slow); d == 0 {
+		t.Fatal("expected delay from the slow limiter")
+	}
+	if after := tokens(fast); after < before {
+		t.Errorf("fast limiter lost tokens while waiting: %v -> %v", before, after)
+	}
+
+	// 병목이 채워질 때까지 기다린 뒤 가져감
+	if err := waitAll(1<<10, nil, time.Time{}, fast, slow); err != nil {
+		t.Fatal(err)
+	}
+	if after := tokens(slow); after >= 1<<9 {
+		t.Errorf("expected slow limiter to be charged; tokens %v", after)
+	}
+}
+
+// TestShapedConnInterrupt 함수는 토큰을 기다리는 쓰기를 Close와 쓰기 데드라인으로 중단할 수 있는지 테스트합니다.
+func TestShapedConnInterrupt(t *testing.T) {
+	for _, name := range []string{"close", "deadline"} {
+		t.Run(name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+			go func() { _, _ = io.Copy(io.Discard, server) }()
+
+			conn, release := NewTrafficShaper(1<<10, 0, 0).Shape(client) // 1KB/s
+			defer release()
+
+			if name == "close" {
+				time.AfterFunc(50*time.Millisecond, func() { _ = conn.Close() })
+			} else {
+				_ = conn.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+			}
+
+			start := time.Now()
+			_, err := conn.Write(make([]byte, 10<<10)) // 제한 없이 기다리면 약 9초
+			if err == nil {
+				t.Fatal("expected write to be interrupted")
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("write was interrupted after %s", elapsed)
+			}
+			_ = conn.Close()
+		})
+	}
+}
+
+// echoThrough는 프록시를 통해 size 바이트를 보내고 에코된 데이터를 모두 받을 때까지 걸린 시간을 반환합니다.
+func echoThrough(t *testing.T, addr string, size int) time.Duration {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	defer conn.Close()
+
+	payload := bytes.Repeat([]byte("x"), size)
+	start := time.Now()
+	go func() { _, _ = conn.Write(payload) }()
+
+	if _, err := io.ReadFull(conn, make([]byte, size)); err != nil {
+		t.Error(err)
+	}
+	return time.Since(start)
+}
+
+// TestProxyBandwidthPerConn 함수는 연결별 제한이 두 방향을 합한 처리량에 적용되는지 테스트합니다.
+func TestProxyBandwidthPerConn(t *testing.T) {
+	server := newPongServer(t)
+	addr := serveProxy(t, &Proxy{
+		Upstream: server.Addr().String(),
+		Shaper:   NewTrafficShaper(100<<10, 0, 0), // 연결당 100KB/s
+	})
+
+	// 25KB를 보내고 25KB를 받으면 50KB가 제한을 통과하므로 최소 0.3초 이상 걸려야 함 (버킷에 쌓인 10KB 제외)
+	if elapsed := echoThrough(t, addr, 25<<10); elapsed < 300*time.Millisecond {
+		t.Errorf("expected transfer to be throttled; took %v", elapsed)
+	}
+}
+
+// TestProxyBandwidthPerIP 함수는 같은 IP의 연결들이 IP별 제한을 나누어 쓰는지 테스트합니다.
+func TestProxyBandwidthPerIP(t *testing.T) {
+	server := newPongServer(t)
+	addr := serveProxy(t, &Proxy{
+		Upstream: server.Addr().String(),
+		Shaper:   NewTrafficShaper(0, 100<<10, 0), // IP당 100KB/s
+	})
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			echoThrough(t, addr, 15<<10) // 두 연결이 합쳐서 60KB를 전달
+		}()
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("expected connections to share the per-IP limit; took %v", elapsed)
+	}
+}
+
+// TestProxyBandwidthSetLimits 함수는 연결을 끊지 않고 제한을 변경할 수 있는지 테스트합니다.
+func TestProxyBandwidthSetLimits(t *testing.T) {
+	server := newPongServer(t)
+	shaper := NewTrafficShaper(0, 0, 20<<10) // 전체 20KB/s
+	addr := serveProxy(t, &Proxy{Upstream: server.Addr().String(), Shaper: shaper})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	pingPong(t, conn) // 낮은 제한에서도 연결은 동작
+
+	// 같은 연결에서 제한을 해제하면 큰 데이터도 빠르게 전달되어야 함
+	shaper.SetLimits(0, 0, 0)
+	start := time.Now()
+	payload := bytes.Repeat([]byte("x"), 256<<10)
+	go func() { _, _ = conn.Write(payload) }()
+	if _, err := io.ReadFull(conn, make([]byte, len(payload))); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected unlimited transfer after SetLimits; took %v", elapsed)
+	}
+}
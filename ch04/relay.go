@@ -0,0 +1,208 @@
+package ch04
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// CloseReason은 프록시 연결이 종료된 이유를 나타냅니다.
+type CloseReason uint8
+
+// 종료 이유 정의
+const (
+	CloseClient      CloseReason = iota + 1 // 1 (클라이언트가 연결을 닫거나 에러 발생)
+	CloseUpstream                           // 2 (업스트림이 연결을 닫거나 에러 발생)
+	CloseIdleTimeout                        // 3 (유휴 타임아웃 초과)
+	CloseLifetime                           // 4 (최대 수명 초과)
+	CloseDialFailure                        // 5 (업스트림 연결 실패)
+	CloseRejected                           // 6 (잘못된 요청이거나 허용되지 않은 연결)
+)
+
+// String 메서드는 종료 이유를 사람이 읽을 수 있는 문자열로 반환합니다.
+func (r CloseReason) String() string {
+	switch r {
+	case CloseClient:
+		return "client closed"
+	case CloseUpstream:
+		return "upstream closed"
+	case CloseIdleTimeout:
+		return "idle timeout"
+	case CloseLifetime:
+		return "max lifetime"
+	case CloseDialFailure:
+		return "dial failure"
+	case CloseRejected:
+		return "rejected"
+	default:
+		return "unknown"
+	}
+}
+
+// relay는 client와 upstream 사이에서 양방향으로 데이터를 전달하고, 전달한 바이트 수를 cs에 기록합니다.
+// 한 방향이 EOF로 끝나면 받는 쪽 연결의 쓰기 방향만 닫아(half-close) 다른 방향은 계속 전달하고,
+// 에러가 발생하거나 쓰기 방향만 닫을 수 없는 연결이면 두 연결을 모두 닫아 다른 방향도 끝냅니다.
+// 먼저 끝난 방향을 기준으로 종료 이유를 반환하되, 나중에 끝난 방향에서 에러가 발생하면 그 에러를 반환합니다.
+func (p *Proxy) relay(client, upstream net.Conn, cs *connStats) (CloseReason, error) {
+	// 유휴 타임아웃: 어느 방향이든 데이터가 오가면 두 연결의 데드라인을 함께 연장
+	var c, u net.Conn = client, upstream
+	if p.IdleTimeout > 0 {
+		c = &idleConn{Conn: client, peer: upstream, timeout: p.IdleTimeout}
+		u = &idleConn{Conn: upstream, peer: client, timeout: p.IdleTimeout}
+		c.(*idleConn).extend()
+	}
+
+	// 최대 수명: 시간이 지나면 두 연결을 강제로 닫음
+	var expired atomic.Bool
+	if p.MaxLifetime > 0 {
+		timer := time.AfterFunc(p.MaxLifetime, func() {
+			expired.Store(true)
+			_ = client.Close()
+			_ = upstream.Close()
+		})
+		defer timer.Stop()
+	}
+
+	type result struct {
+		reason     CloseReason
+		err        error
+		halfClosed bool // EOF로 끝나 dst의 쓰기 방향만 닫았는지 여부
+	}
+	done := make(chan result, 2)
+
+	// half는 src에서 dst로 복사하고, 에러가 발생한 쪽을 종료 이유로 기록
+	// conn은 dst의 원래 연결로, EOF로 끝나면 쓰기 방향을 닫아 상대에게 EOF를 전달
+	half := func(dst, src, conn net.Conn, dir Direction, dstSide, srcSide CloseReason) {
+		readErr, writeErr := p.copy(dst, src, dir, cs.counter(dir))
+		if writeErr != nil {
+			done <- result{reason: dstSide, err: writeErr}
+			return
+		}
+		if readErr != nil {
+			done <- result{reason: srcSide, err: readErr}
+			return
+		}
+		done <- result{reason: srcSide, halfClosed: closeWrite(conn)}
+	}
+	go half(u, c, upstream, ClientToUpstream, CloseUpstream, CloseClient)
+	go half(c, u, client, UpstreamToClient, CloseClient, CloseUpstream)
+
+	res := <-done
+	if res.halfClosed {
+		// 한 방향만 끝났으므로 다른 방향이 끝날 때까지 계속 전달
+		if last := <-done; last.err != nil {
+			res = last
+		}
+	} else {
+		_ = client.Close() // 나머지 방향의 복사도 끝나도록 두 연결을 닫음
+		_ = upstream.Close()
+		<-done
+	}
+
+	switch {
+	case expired.Load():
+		return CloseLifetime, nil
+	case isTimeout(res.err):
+		return CloseIdleTimeout, res.err
+	}
+	return res.reason, res.err
+}
+
+// copy는 dir 방향으로 데이터를 전달하고, dst에 쓴 바이트 수를 count로 알립니다.
+// Frames가 설정되어 있으면 프레임 단위로 전달하고, Splice가 켜져 있고 두 연결이 모두 감싸지 않은 TCP 연결이면
+// (*net.TCPConn).ReadFrom을 사용해 Linux에서 splice(2)로 데이터를 옮깁니다.
+func (p *Proxy) copy(dst io.Writer, src io.Reader, dir Direction, count func(n int64)) (readErr, writeErr error) {
+	if p.Frames != nil {
+		return p.Frames.copyFrames(&countWriter{Writer: dst, count: count}, src, dir)
+	}
+	if !p.Splice {
+		return copyHalf(&countWriter{Writer: dst, count: count}, src)
+	}
+	if d, ok := dst.(*net.TCPConn); ok {
+		if s, ok := src.(*net.TCPConn); ok {
+			if readErr, writeErr, ok := readFromHalf(d, s, count); ok {
+				return readErr, writeErr
+			}
+		}
+	}
+	return copyHalf(&countWriter{Writer: dst, count: count}, src)
+}
+
+// copyHalf는 src에서 읽은 데이터를 dst에 쓰며, 종료 원인이 읽기 쪽인지 쓰기 쪽인지 구분해 반환합니다.
+// src가 EOF로 끝나면 두 에러 모두 nil입니다.
+func copyHalf(dst io.Writer, src io.Reader) (readErr, writeErr error) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, wErr := dst.Write(buf[:n]); wErr != nil {
+				return nil, wErr
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return err, nil
+		}
+	}
+}
+
+// closeWrite는 conn의 쓰기 방향만 닫아 상대에게 EOF를 알리며, 성공하면 true를 반환합니다.
+// NetConn으로 감싼 연결을 벗겨 가며 쓰기 방향을 닫을 수 있는 연결(TCP, Unix 소켓, TLS)을 찾습니다.
+func closeWrite(conn net.Conn) bool {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c.CloseWrite() == nil
+		case *net.UnixConn:
+			return c.CloseWrite() == nil
+		case *tls.Conn:
+			return c.CloseWrite() == nil // TLS 연결은 close_notify를 보냄
+		}
+		w, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			return false
+		}
+		conn = w.NetConn()
+	}
+}
+
+// isTimeout은 err가 타임아웃 에러인지 확인합니다.
+func isTimeout(err error) bool {
+	var nErr net.Error
+	return errors.As(err, &nErr) && nErr.Timeout()
+}
+
+// idleConn은 데이터를 읽거나 쓸 때마다 자신과 상대 연결의 데드라인을 연장하는 net.Conn입니다.
+type idleConn struct {
+	net.Conn
+	peer    net.Conn
+	timeout time.Duration
+}
+
+// extend는 두 연결의 데드라인을 지금부터 timeout 이후로 설정합니다.
+func (c *idleConn) extend() {
+	deadline := time.Now().Add(c.timeout)
+	_ = c.Conn.SetDeadline(deadline)
+	_ = c.peer.SetDeadline(deadline)
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.extend()
+	}
+	return n, err
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.extend()
+	}
+	return n, err
+}
@@ -0,0 +1,40 @@
+//go:build linux
+
+package ch04
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// spliceChunk는 readFromHalf가 ReadFrom 한 번으로 옮기는 최대 바이트 수입니다.
+// ReadFrom은 이만큼 옮기거나 EOF를 만날 때까지 반환하지 않으므로 바이트 수는 이 단위로 늦게 기록됩니다.
+const spliceChunk = 1 << 20
+
+// readFromHalf는 dst.ReadFrom으로 src의 데이터를 옮기고, 옮긴 바이트 수를 count로 알립니다.
+// 두 연결이 모두 TCP이므로 표준 라이브러리가 splice(2)를 사용해 데이터를 사용자 공간으로 복사하지 않습니다.
+// 조각마다 읽을 수 있는 바이트 수를 확인하는 시스템 호출을 더하지 않도록 spliceChunk 단위로 옮기며,
+// 그 대신 바이트 수는 조각이 끝날 때마다 알립니다.
+// ReadFrom의 에러는 어느 쪽에서 발생했는지 알려 주지 않으므로, 타임아웃은 읽기 쪽으로,
+// 끊어진 파이프(EPIPE)는 쓰기 쪽으로, 그 밖의 에러는 읽기 쪽으로 봅니다.
+// 항상 ok로 true를 반환합니다.
+func readFromHalf(dst, src *net.TCPConn, count func(n int64)) (readErr, writeErr error, ok bool) {
+	for {
+		written, err := dst.ReadFrom(&io.LimitedReader{R: src, N: spliceChunk})
+		if written > 0 {
+			count(written)
+		}
+		switch {
+		case err == nil && written < spliceChunk:
+			return nil, nil, true // EOF
+		case err == nil:
+			continue
+		case !isTimeout(err) && errors.Is(err, syscall.EPIPE):
+			return nil, err, true
+		default:
+			return err, nil, true
+		}
+	}
+}
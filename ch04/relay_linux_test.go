@@ -0,0 +1,167 @@
+package ch04
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// tcpPair는 루프백으로 연결된 TCP 연결 한 쌍을 반환합니다.
+func tcpPair(tb testing.TB) (*net.TCPConn, *net.TCPConn) {
+	tb.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			tb.Error(err)
+		}
+		accepted <- conn
+	}()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	server := <-accepted
+	tb.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+
+	return client.(*net.TCPConn), server.(*net.TCPConn)
+}
+
+// TestReadFromHalf 함수는 ReadFrom(splice) 경로가 데이터를 손실 없이 전달하고 바이트 수를 모두 알리는지 테스트합니다.
+func TestReadFromHalf(t *testing.T) {
+	writer, src := tcpPair(t)
+	dst, reader := tcpPair(t)
+
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 1<<16) // 1MB
+	go func() {
+		_, _ = writer.Write(payload)
+		_ = writer.Close()
+	}()
+
+	received := make(chan []byte, 1)
+	go func() {
+		buf, _ := io.ReadAll(reader)
+		received <- buf
+	}()
+
+	var counted int64
+	readErr, writeErr, ok := readFromHalf(dst, src, func(n int64) { counted += n })
+	if !ok || readErr != nil || writeErr != nil {
+		t.Fatalf("unexpected result: ok=%t read=%v write=%v", ok, readErr, writeErr)
+	}
+	if counted != int64(len(payload)) {
+		t.Errorf("expected %d bytes counted; actual %d", len(payload), counted)
+	}
+	_ = dst.Close()
+
+	if buf := <-received; !bytes.Equal(buf, payload) {
+		t.Errorf("expected %d bytes; received %d", len(payload), len(buf))
+	}
+}
+
+// TestReadFromHalfDeadline 함수는 ReadFrom 경로에서도 연결의 데드라인이 적용되는지 테스트합니다.
+func TestReadFromHalfDeadline(t *testing.T) {
+	_, src := tcpPair(t)
+	dst, _ := tcpPair(t)
+
+	_ = src.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if readErr, _, ok := readFromHalf(dst, src, func(int64) {}); !ok || !isTimeout(readErr) {
+		t.Errorf("expected timeout error; actual ok=%t %v", ok, readErr)
+	}
+}
+
+// cpuTime은 현재 프로세스가 사용한 사용자 및 시스템 CPU 시간의 합을 반환합니다.
+func cpuTime() time.Duration {
+	var usage syscall.Rusage
+	_ = syscall.Getrusage(syscall.RUSAGE_SELF, &usage)
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+// benchmarkHalf는 half 함수로 루프백 TCP 연결 사이에서 b.N * 64KB를 전달하며,
+// 처리량과 함께 작업당 CPU 시간을 보고합니다.
+func benchmarkHalf(b *testing.B, half func(dst *net.TCPConn, src *net.TCPConn) (error, error)) {
+	const chunk = 64 * 1024
+
+	writer, src := tcpPair(b)
+	dst, reader := tcpPair(b)
+
+	go func() {
+		buf := make([]byte, chunk)
+		for i := 0; i < b.N; i++ {
+			if _, err := writer.Write(buf); err != nil {
+				return
+			}
+		}
+		_ = writer.Close()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, reader)
+		close(done)
+	}()
+
+	b.SetBytes(chunk)
+	b.ResetTimer()
+	start := cpuTime()
+
+	if readErr, writeErr := half(dst, src); readErr != nil || writeErr != nil {
+		b.Fatal(readErr, writeErr)
+	}
+	_ = dst.Close()
+	<-done
+
+	b.StopTimer()
+	b.ReportMetric(float64(cpuTime()-start)/float64(b.N), "cpu-ns/op")
+}
+
+// BenchmarkRelaySplice는 (*net.TCPConn).ReadFrom이 splice(2)를 사용하는 제로 카피 경로의 성능을 측정합니다.
+func BenchmarkRelaySplice(b *testing.B) {
+	benchmarkHalf(b, func(dst *net.TCPConn, src *net.TCPConn) (error, error) {
+		readErr, writeErr, _ := readFromHalf(dst, src, func(int64) {})
+		return readErr, writeErr
+	})
+}
+
+// BenchmarkRelayCopy는 사용자 공간 버퍼를 거치는 copyHalf 경로의 성능을 측정합니다.
+func BenchmarkRelayCopy(b *testing.B) {
+	benchmarkHalf(b, func(dst *net.TCPConn, src *net.TCPConn) (error, error) {
+		return copyHalf(dst, src)
+	})
+}
+
+// TestProxySplice 함수는 Splice를 켠 프록시가 splice 경로로 데이터를 전달하고,
+// 연결이 끝나면 전달한 바이트 수를 모두 기록하는지 테스트합니다.
+func TestProxySplice(t *testing.T) {
+	server := newPongServer(t)
+	onClose, reasons := closeRecorder()
+	p := &Proxy{Upstream: server.Addr().String(), Splice: true, OnClose: onClose}
+	addr := serveProxy(t, p)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pingPong(t, conn)
+	pingPong(t, conn)
+	_ = conn.Close()
+	expectReason(t, reasons, CloseClient)
+
+	if stats := p.Stats(); stats.Bytes[ClientToUpstream] != 8 || stats.Bytes[UpstreamToClient] != 8 {
+		t.Errorf("expected 8 bytes in each direction; actual %v", stats.Bytes)
+	}
+}
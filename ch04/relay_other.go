@@ -0,0 +1,11 @@
+//go:build !linux
+
+package ch04
+
+import "net"
+
+// readFromHalf는 splice(2)를 지원하지 않는 플랫폼에서 항상 ok로 false를 반환하며,
+// 호출자는 copyHalf를 사용해야 합니다.
+func readFromHalf(dst, src *net.TCPConn, count func(n int64)) (readErr, writeErr error, ok bool) {
+	return nil, nil, false
+}
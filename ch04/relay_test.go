@@ -0,0 +1,224 @@
+package ch04
+
+import (
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// closeRecorder는 OnClose 콜백으로 전달된 종료 이유를 채널로 받는 테스트 도우미입니다.
+func closeRecorder() (func(net.Conn, CloseReason, error), <-chan CloseReason) {
+	reasons := make(chan CloseReason, 1)
+	return func(_ net.Conn, reason CloseReason, _ error) { reasons <- reason }, reasons
+}
+
+// expectReason은 지정된 시간 안에 기대한 종료 이유가 기록되는지 확인합니다.
+func expectReason(t *testing.T, reasons <-chan CloseReason, expected CloseReason) {
+	t.Helper()
+
+	select {
+	case actual := <-reasons:
+		if actual != expected {
+			t.Errorf("expected close reason %q; actual %q", expected, actual)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("connection was not closed; expected %q", expected)
+	}
+}
+
+// TestProxyIdleTimeout 함수는 데이터가 오가지 않는 연결이 유휴 타임아웃으로 끊기는지 테스트합니다.
+func TestProxyIdleTimeout(t *testing.T) {
+	server := newPongServer(t)
+	onClose, reasons := closeRecorder()
+	addr := serveProxy(t, &Proxy{
+		Upstream:    server.Addr().String(),
+		IdleTimeout: 100 * time.Millisecond,
+		OnClose:     onClose,
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 유휴 타임아웃보다 짧은 간격으로 통신하면 연결이 유지되어야 함
+	for i := 0; i < 5; i++ {
+		pingPong(t, conn)
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// 통신을 멈추면 프록시가 연결을 끊어야 함
+	expectReason(t, reasons, CloseIdleTimeout)
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("expected connection to be closed by proxy")
+	}
+}
+
+// TestProxyMaxLifetime 함수는 계속 통신 중인 연결도 최대 수명이 지나면 끊기는지 테스트합니다.
+func TestProxyMaxLifetime(t *testing.T) {
+	server := newPongServer(t)
+	onClose, reasons := closeRecorder()
+	addr := serveProxy(t, &Proxy{
+		Upstream:    server.Addr().String(),
+		IdleTimeout: time.Second,
+		MaxLifetime: 100 * time.Millisecond,
+		OnClose:     onClose,
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	go func() {
+		for {
+			if _, err := conn.Write([]byte("ping")); err != nil {
+				return
+			}
+			if _, err := conn.Read(make([]byte, 4)); err != nil {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	expectReason(t, reasons, CloseLifetime)
+}
+
+// TestProxyCloseReason 함수는 클라이언트 종료, 업스트림 종료, 연결 실패를 구분해 기록하는지 테스트합니다.
+func TestProxyCloseReason(t *testing.T) {
+	t.Run("client", func(t *testing.T) {
+		server := newPongServer(t)
+		onClose, reasons := closeRecorder()
+		addr := serveProxy(t, &Proxy{Upstream: server.Addr().String(), OnClose: onClose})
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pingPong(t, conn)
+		_ = conn.Close()
+
+		expectReason(t, reasons, CloseClient)
+	})
+
+	t.Run("upstream", func(t *testing.T) {
+		// 연결을 수락하자마자 닫는 업스트림
+		listener, err := net.Listen("tcp", "127.0.0.1:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				_ = conn.Close()
+			}
+		}()
+
+		onClose, reasons := closeRecorder()
+		addr := serveProxy(t, &Proxy{Upstream: listener.Addr().String(), OnClose: onClose})
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		// 업스트림의 종료는 EOF로 전달되고, 클라이언트도 닫으면 연결이 끝남
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("expected EOF; actual %v", err)
+		}
+		_ = conn.Close()
+
+		expectReason(t, reasons, CloseUpstream)
+	})
+
+	t.Run("dial timeout", func(t *testing.T) {
+		// Control 함수에서 DialTimeout보다 오래 지연시켜 연결 타임아웃을 유도
+		dialer := &net.Dialer{Control: func(_, _ string, _ syscall.RawConn) error {
+			time.Sleep(200 * time.Millisecond)
+			return nil
+		}}
+
+		errs := make(chan error, 1)
+		addr := serveProxy(t, &Proxy{
+			Upstream:    "10.0.0.1:80",
+			Dialer:      dialer,
+			DialTimeout: 50 * time.Millisecond,
+			OnClose: func(_ net.Conn, reason CloseReason, err error) {
+				if reason != CloseDialFailure {
+					t.Errorf("expected close reason %q; actual %q", CloseDialFailure, reason)
+				}
+				errs <- err
+			},
+		})
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		if err := <-errs; !isTimeout(err) {
+			t.Errorf("expected timeout error; actual %v", err)
+		}
+	})
+}
+
+// TestProxyHalfClose 함수는 클라이언트가 쓰기 방향만 닫아도 업스트림의 응답을 끝까지 받는지 테스트합니다.
+func TestProxyHalfClose(t *testing.T) {
+	// EOF까지 읽은 뒤에 응답하는 업스트림
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		msg, err := io.ReadAll(conn)
+		if err != nil {
+			return
+		}
+		_, _ = conn.Write(append([]byte("echo:"), msg...))
+	}()
+
+	onClose, reasons := closeRecorder()
+	addr := serveProxy(t, &Proxy{Upstream: listener.Addr().String(), OnClose: onClose})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != "echo:hi" {
+		t.Errorf("expected %q; actual %q", "echo:hi", reply)
+	}
+
+	expectReason(t, reasons, CloseClient) // 클라이언트 쪽이 먼저 끝남
+}
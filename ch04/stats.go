@@ -0,0 +1,349 @@
+package ch04
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 히스토그램 버킷의 상한 (초)
+var (
+	durationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 1800}
+	dialBuckets     = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+)
+
+// String 메서드는 방향을 메트릭 레이블에 쓸 수 있는 문자열로 반환합니다.
+func (d Direction) String() string {
+	switch d {
+	case ClientToUpstream:
+		return "client_to_upstream"
+	case UpstreamToClient:
+		return "upstream_to_client"
+	default:
+		return "unknown"
+	}
+}
+
+// Histogram은 관측값의 분포입니다. Counts[i]는 Bounds[i] 이하인 관측값의 누적 개수입니다.
+type Histogram struct {
+	Bounds []float64 // 버킷의 상한 (초)
+	Counts []uint64
+	Count  uint64  // 전체 관측 횟수
+	Sum    float64 // 관측값의 합 (초)
+}
+
+// ConnStats는 처리 중인 연결 하나의 통계입니다.
+type ConnStats struct {
+	Client   net.Addr
+	Upstream net.Addr // 업스트림에 연결하기 전이면 nil
+	Start    time.Time
+	Bytes    map[Direction]uint64 // 방향별로 전달한 바이트 수
+}
+
+// StatsSnapshot은 Stats를 호출한 시점의 프록시 통계입니다.
+type StatsSnapshot struct {
+	Active int    // 현재 처리 중인 연결 수
+	Total  uint64 // 처리를 시작한 전체 연결 수
+
+	Bytes  map[Direction]uint64   // 방향별로 전달한 전체 바이트 수
+	Closed map[CloseReason]uint64 // 종료 이유별 연결 수 (연결 수 제한으로 거부된 연결 포함)
+	Errors map[CloseReason]uint64 // 에러와 함께 끝난 연결 수를 종료 이유별로 센 값
+
+	Durations   Histogram // 끝난 연결의 지속 시간
+	DialLatency Histogram // 업스트림 연결에 걸린 시간
+
+	Conns []ConnStats // 처리 중인 연결 목록 (시작 시각 순)
+}
+
+// histogram은 bounds를 상한으로 하는 버킷에 관측값을 누적합니다. 0 값은 빈 히스토그램입니다.
+type histogram struct {
+	counts []uint64 // 버킷별 개수 (누적 아님)
+	count  uint64
+	sum    float64
+}
+
+// observe는 관측값 d를 추가합니다.
+func (h *histogram) observe(bounds []float64, d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(bounds))
+	}
+
+	v := d.Seconds()
+	if i := sort.SearchFloat64s(bounds, v); i < len(bounds) {
+		h.counts[i]++ // 상한을 넘는 값은 +Inf 버킷(count)에만 포함
+	}
+	h.count++
+	h.sum += v
+}
+
+// snapshot은 버킷별 개수를 누적 개수로 변환한 Histogram을 반환합니다.
+func (h *histogram) snapshot(bounds []float64) Histogram {
+	s := Histogram{Bounds: bounds, Counts: make([]uint64, len(bounds)), Count: h.count, Sum: h.sum}
+	var cumulative uint64
+	for i := range h.counts {
+		cumulative += h.counts[i]
+		s.Counts[i] = cumulative
+	}
+	return s
+}
+
+// proxyStats는 Proxy의 통계를 수집합니다. 바이트 수는 데이터를 전달할 때마다 갱신되므로 원자적으로 더합니다.
+type proxyStats struct {
+	mu          sync.Mutex
+	total       uint64
+	conns       map[*connStats]struct{}
+	closed      map[CloseReason]uint64
+	errors      map[CloseReason]uint64
+	durations   histogram
+	dialLatency histogram
+
+	bytes [UpstreamToClient + 1]atomic.Uint64
+}
+
+// connStats는 연결 하나의 통계입니다.
+type connStats struct {
+	stats    *proxyStats
+	client   net.Addr
+	upstream net.Addr // stats.mu로 보호
+	start    time.Time
+
+	bytes [UpstreamToClient + 1]atomic.Uint64
+}
+
+// open은 새 연결의 통계를 등록합니다.
+func (s *proxyStats) open(conn net.Conn) *connStats {
+	cs := &connStats{stats: s, client: conn.RemoteAddr(), start: time.Now()}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns == nil {
+		s.conns = make(map[*connStats]struct{})
+	}
+	s.conns[cs] = struct{}{}
+	s.total++
+	return cs
+}
+
+// close는 연결이 끝났음을 기록합니다. cs가 nil이면 처리를 시작하기 전에 거부된 연결입니다.
+func (s *proxyStats) close(cs *connStats, reason CloseReason, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cs != nil {
+		delete(s.conns, cs)
+		s.durations.observe(durationBuckets, time.Since(cs.start))
+	}
+
+	if s.closed == nil {
+		s.closed = make(map[CloseReason]uint64)
+		s.errors = make(map[CloseReason]uint64)
+	}
+	s.closed[reason]++
+	if err != nil {
+		s.errors[reason]++
+	}
+}
+
+// observeDial은 업스트림 연결에 걸린 시간을 기록합니다.
+func (s *proxyStats) observeDial(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dialLatency.observe(dialBuckets, d)
+}
+
+// setUpstream은 연결된 업스트림의 주소를 기록합니다.
+func (cs *connStats) setUpstream(addr net.Addr) {
+	cs.stats.mu.Lock()
+	cs.upstream = addr
+	cs.stats.mu.Unlock()
+}
+
+// counter는 dir 방향으로 전달한 바이트 수를 연결과 프록시 전체 통계에 더하는 함수를 반환합니다.
+func (cs *connStats) counter(dir Direction) func(n int64) {
+	return func(n int64) {
+		cs.bytes[dir].Add(uint64(n))
+		cs.stats.bytes[dir].Add(uint64(n))
+	}
+}
+
+// Stats는 현재 프록시 통계의 스냅숏을 반환합니다.
+func (p *Proxy) Stats() StatsSnapshot {
+	s := &p.shared().stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := StatsSnapshot{
+		Active: len(s.conns),
+		Total:  s.total,
+		Bytes: map[Direction]uint64{
+			ClientToUpstream: s.bytes[ClientToUpstream].Load(),
+			UpstreamToClient: s.bytes[UpstreamToClient].Load(),
+		},
+		Closed: make(map[CloseReason]uint64),
+		Errors: make(map[CloseReason]uint64),
+	}
+	for reason, n := range s.closed {
+		snap.Closed[reason] = n
+	}
+	for reason, n := range s.errors {
+		snap.Errors[reason] = n
+	}
+
+	snap.Durations = s.durations.snapshot(durationBuckets)
+	snap.DialLatency = s.dialLatency.snapshot(dialBuckets)
+
+	for cs := range s.conns {
+		snap.Conns = append(snap.Conns, ConnStats{
+			Client:   cs.client,
+			Upstream: cs.upstream,
+			Start:    cs.start,
+			Bytes: map[Direction]uint64{
+				ClientToUpstream: cs.bytes[ClientToUpstream].Load(),
+				UpstreamToClient: cs.bytes[UpstreamToClient].Load(),
+			},
+		})
+	}
+	sort.Slice(snap.Conns, func(i, j int) bool { return snap.Conns[i].Start.Before(snap.Conns[j].Start) })
+
+	return snap
+}
+
+// countWriter는 쓴 바이트 수를 count로 알리는 io.Writer입니다.
+type countWriter struct {
+	io.Writer
+	count func(n int64)
+}
+
+func (w *countWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	if n > 0 {
+		w.count(int64(n))
+	}
+	return n, err
+}
+
+// MetricsHandler는 프록시 통계를 Prometheus 텍스트 형식으로 제공하는 HTTP 핸들러를 반환합니다.
+// 예를 들어 http.ListenAndServe("127.0.0.1:9100", p.MetricsHandler())로 로컬 엔드포인트를 열 수 있습니다.
+func (p *Proxy) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, []labeledStats{{"", p.Stats()}})
+	})
+}
+
+// MetricsHandler는 모든 경로의 프록시 통계를 route 레이블과 함께 Prometheus 텍스트 형식으로 제공하는 HTTP 핸들러를 반환합니다.
+// 연결 수와 통계는 경로 이름별로 이어지므로, 설정이 바뀐 경로도 이전 프록시의 값에 이어서 셉니다.
+func (m *RouteManager) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		m.mu.Lock()
+		var stats []labeledStats
+		for name, r := range m.routes {
+			stats = append(stats, labeledStats{`route="` + escapeLabel(name) + `"`, r.current().Stats()})
+		}
+		m.mu.Unlock()
+		sort.Slice(stats, func(i, j int) bool { return stats[i].labels < stats[j].labels })
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, stats)
+	})
+}
+
+// labeledStats는 레이블과 함께 출력할 통계입니다.
+type labeledStats struct {
+	labels string // `route="api"` 형태 (비어 있으면 레이블 없음)
+	snap   StatsSnapshot
+}
+
+// writeMetrics는 통계를 Prometheus 텍스트 형식으로 작성합니다. 메트릭마다 HELP와 TYPE을 한 번씩 씁니다.
+func writeMetrics(w io.Writer, stats []labeledStats) {
+	// series는 기본 레이블에 추가 레이블을 붙인 시계열 이름을 반환
+	series := func(name, labels, extra string) string {
+		switch {
+		case labels == "" && extra == "":
+			return name
+		case labels == "":
+			return name + "{" + extra + "}"
+		case extra == "":
+			return name + "{" + labels + "}"
+		}
+		return name + "{" + labels + "," + extra + "}"
+	}
+	header := func(name, typ, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	header("proxy_active_connections", "gauge", "Number of connections currently being proxied.")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s %d\n", series("proxy_active_connections", s.labels, ""), s.snap.Active)
+	}
+
+	header("proxy_connections_total", "counter", "Number of connections accepted for proxying.")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s %d\n", series("proxy_connections_total", s.labels, ""), s.snap.Total)
+	}
+
+	header("proxy_bytes_total", "counter", "Bytes forwarded by direction.")
+	for _, s := range stats {
+		for _, dir := range []Direction{ClientToUpstream, UpstreamToClient} {
+			fmt.Fprintf(w, "%s %d\n",
+				series("proxy_bytes_total", s.labels, `direction="`+dir.String()+`"`), s.snap.Bytes[dir])
+		}
+	}
+
+	reasons := func(counts map[CloseReason]uint64) []CloseReason {
+		var list []CloseReason
+		for reason := range counts {
+			list = append(list, reason)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+		return list
+	}
+
+	header("proxy_connections_closed_total", "counter", "Closed connections by close reason.")
+	for _, s := range stats {
+		for _, reason := range reasons(s.snap.Closed) {
+			fmt.Fprintf(w, "%s %d\n", series("proxy_connections_closed_total", s.labels,
+				`reason="`+escapeLabel(reason.String())+`"`), s.snap.Closed[reason])
+		}
+	}
+
+	header("proxy_connection_errors_total", "counter", "Connections that ended with an error by close reason.")
+	for _, s := range stats {
+		for _, reason := range reasons(s.snap.Errors) {
+			fmt.Fprintf(w, "%s %d\n", series("proxy_connection_errors_total", s.labels,
+				`reason="`+escapeLabel(reason.String())+`"`), s.snap.Errors[reason])
+		}
+	}
+
+	histogram := func(name, help string, get func(StatsSnapshot) Histogram) {
+		header(name, "histogram", help)
+		for _, s := range stats {
+			h := get(s.snap)
+			for i, bound := range h.Bounds {
+				le := `le="` + strconv.FormatFloat(bound, 'g', -1, 64) + `"`
+				fmt.Fprintf(w, "%s %d\n", series(name+"_bucket", s.labels, le), h.Counts[i])
+			}
+			fmt.Fprintf(w, "%s %d\n", series(name+"_bucket", s.labels, `le="+Inf"`), h.Count)
+			fmt.Fprintf(w, "%s %g\n", series(name+"_sum", s.labels, ""), h.Sum)
+			fmt.Fprintf(w, "%s %d\n", series(name+"_count", s.labels, ""), h.Count)
+		}
+	}
+	histogram("proxy_connection_duration_seconds", "Duration of closed connections.",
+		func(s StatsSnapshot) Histogram { return s.Durations })
+	histogram("proxy_dial_duration_seconds", "Time taken to connect to the upstream.",
+		func(s StatsSnapshot) Histogram { return s.DialLatency })
+}
+
+// labelEscaper는 Prometheus 레이블 값에 쓸 수 있도록 역슬래시, 큰따옴표, 줄바꿈을 이스케이프합니다.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel은 s를 Prometheus 레이블 값으로 이스케이프합니다.
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
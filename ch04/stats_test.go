@@ -0,0 +1,123 @@
+package ch04
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestProxyStats 함수는 연결별 통계와 전체 통계가 올바르게 집계되는지 테스트합니다.
+func TestProxyStats(t *testing.T) {
+	server := newPongServer(t)
+	onClose, reasons := closeRecorder()
+	p := &Proxy{Upstream: server.Addr().String(), OnClose: onClose}
+	addr := serveProxy(t, p)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pingPong(t, conn)
+	pingPong(t, conn)
+
+	// 응답을 받은 직후에는 프록시가 아직 쓴 바이트 수를 기록하기 전일 수 있으므로 잠시 기다림
+	stats := p.Stats()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); stats = p.Stats() {
+		if stats.Bytes[UpstreamToClient] == 8 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats.Active != 1 || stats.Total != 1 || len(stats.Conns) != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	cs := stats.Conns[0]
+	if cs.Client.String() != conn.LocalAddr().String() || cs.Upstream.String() != server.Addr().String() {
+		t.Errorf("unexpected addresses: client %v, upstream %v", cs.Client, cs.Upstream)
+	}
+	if cs.Bytes[ClientToUpstream] != 8 || cs.Bytes[UpstreamToClient] != 8 {
+		t.Errorf("expected 8 bytes in each direction; actual %v", cs.Bytes)
+	}
+	if stats.DialLatency.Count != 1 {
+		t.Errorf("expected 1 dial observation; actual %d", stats.DialLatency.Count)
+	}
+
+	_ = conn.Close()
+	expectReason(t, reasons, CloseClient)
+
+	stats = p.Stats()
+	if stats.Active != 0 || stats.Closed[CloseClient] != 1 || stats.Durations.Count != 1 {
+		t.Errorf("unexpected stats after close: %+v", stats)
+	}
+	if stats.Bytes[ClientToUpstream] != 8 || stats.Bytes[UpstreamToClient] != 8 {
+		t.Errorf("expected 8 bytes in each direction; actual %v", stats.Bytes)
+	}
+	if last := len(stats.Durations.Counts) - 1; stats.Durations.Counts[last] != 1 {
+		t.Errorf("expected cumulative bucket count 1; actual %v", stats.Durations.Counts)
+	}
+}
+
+// TestProxyStatsErrors 함수는 업스트림 연결 실패가 종료 이유별 에러로 집계되는지 테스트합니다.
+func TestProxyStatsErrors(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = closed.Close()
+
+	onClose, reasons := closeRecorder()
+	p := &Proxy{Upstream: closed.Addr().String(), OnClose: onClose}
+	expectClosed(t, serveProxy(t, p))
+	expectReason(t, reasons, CloseDialFailure)
+
+	stats := p.Stats()
+	if stats.Errors[CloseDialFailure] != 1 || stats.DialLatency.Count != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+// TestMetricsHandler 함수는 통계를 Prometheus 텍스트 형식으로 출력하는지 테스트합니다.
+func TestMetricsHandler(t *testing.T) {
+	server := newPongServer(t)
+	onClose, reasons := closeRecorder()
+
+	m := &RouteManager{OnClose: onClose}
+	defer m.Close()
+	err := m.Apply(&Config{Routes: []RouteConfig{
+		{Name: "api", Listen: "127.0.0.1:0", Upstreams: []string{server.Addr().String()}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := routeConn(t, m, "api")
+	pingPong(t, conn)
+	_ = conn.Close()
+	expectReason(t, reasons, CloseClient)
+
+	rec := httptest.NewRecorder()
+	m.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, line := range []string{
+		"# TYPE proxy_active_connections gauge",
+		`proxy_active_connections{route="api"} 0`,
+		`proxy_connections_total{route="api"} 1`,
+		`proxy_bytes_total{route="api",direction="client_to_upstream"} 4`,
+		`proxy_bytes_total{route="api",direction="upstream_to_client"} 4`,
+		`proxy_connections_closed_total{route="api",reason="client closed"} 1`,
+		"# TYPE proxy_connection_duration_seconds histogram",
+		`proxy_connection_duration_seconds_bucket{route="api",le="+Inf"} 1`,
+		`proxy_dial_duration_seconds_count{route="api"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected line %q in metrics:\n%s", line, body)
+		}
+	}
+
+	if escapeLabel("a\"b\\c\n") != `a\"b\\c\n` {
+		t.Errorf("unexpected escaping: %q", escapeLabel("a\"b\\c\n"))
+	}
+}
@@ -0,0 +1,187 @@
+package ch04
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrNoCertificates는 CA 번들 파일에서 인증서를 찾지 못했을 때 반환됩니다.
+var ErrNoCertificates = errors.New("no certificates found")
+
+const (
+	defaultHandshakeTimeout = 10 * time.Second // TLS 핸드셰이크와 CONNECT 요청을 기다리는 기본 시간
+	defaultWatchInterval    = 30 * time.Second // Watch가 파일의 수정 시각을 확인하는 기본 간격
+)
+
+// certTimes는 인증서와 키 파일의 수정 시각입니다.
+type certTimes struct {
+	cert, key time.Time
+}
+
+// statCert는 인증서와 키 파일의 수정 시각을 읽습니다.
+func (r *CertReloader) statCert() (certTimes, error) {
+	cert, err := os.Stat(r.certFile)
+	if err != nil {
+		return certTimes{}, err
+	}
+	key, err := os.Stat(r.keyFile)
+	if err != nil {
+		return certTimes{}, err
+	}
+	return certTimes{cert: cert.ModTime(), key: key.ModTime()}, nil
+}
+
+// CertReloader는 인증서와 키 파일을 읽어 두었다가 Reload가 호출되면 다시 읽습니다.
+// 새 파일을 읽지 못하면 이전 인증서를 계속 사용합니다.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	// OnReload가 설정되면 Watch에 의한 자동 재로드가 끝날 때마다 결과와 함께 호출됨
+	OnReload func(err error)
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime certTimes // 마지막으로 읽은 인증서와 키 파일의 수정 시각
+}
+
+// NewCertReloader는 인증서와 키 파일을 읽어 CertReloader를 생성합니다.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload는 인증서와 키 파일을 다시 읽습니다. 실패하면 이전 인증서를 그대로 유지합니다.
+func (r *CertReloader) Reload() error {
+	times, err := r.statCert()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = times
+	r.mu.Unlock()
+
+	return nil
+}
+
+// GetCertificate는 현재 인증서를 반환합니다. tls.Config의 GetCertificate 필드에 사용합니다.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch는 SIGHUP 신호를 받거나 interval마다 확인한 인증서나 키 파일의 수정 시각이 바뀌면 인증서를 다시 읽습니다.
+// interval이 0 이하이면 defaultWatchInterval을 사용합니다.
+// 인증서와 키 파일을 차례로 교체하는 도중에 읽어 실패하더라도 나머지 파일이 바뀌면 다시 시도합니다.
+// 신호 등록은 Watch가 반환되기 전에 끝나며, ctx가 취소되면 감시를 멈춥니다.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hup)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var failed certTimes // 실패한 파일을 매번 다시 읽지 않도록 마지막으로 실패한 수정 시각을 기억
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup: // SIGHUP을 받으면 무조건 다시 읽음
+			case <-ticker.C:
+				times, err := r.statCert()
+				r.mu.RLock()
+				seen := r.modTime // 성공적으로 읽은 파일의 수정 시각
+				r.mu.RUnlock()
+				if err != nil || times == seen || times == failed {
+					continue
+				}
+				failed = times // 성공하면 seen이 바뀌므로 다시 읽지 않음
+			}
+
+			err := r.Reload()
+			if r.OnReload != nil {
+				r.OnReload(err)
+			}
+		}
+	}()
+}
+
+// LoadCABundle은 PEM 형식의 CA 번들 파일을 읽어 인증서 풀을 생성합니다.
+// 업스트림 TLS 연결의 RootCAs에 사용합니다.
+func LoadCABundle(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, ErrNoCertificates
+	}
+	return pool, nil
+}
+
+// handshakeTimeout은 실제로 적용할 핸드셰이크 제한 시간을 반환합니다.
+func (p *Proxy) handshakeTimeout() time.Duration {
+	if p.HandshakeTimeout > 0 {
+		return p.HandshakeTimeout
+	}
+	return defaultHandshakeTimeout
+}
+
+// serverTLS는 클라이언트 연결에서 TLS 핸드셰이크를 수행하고 복호화된 연결을 반환합니다.
+// ClientHello를 보내지 않는 클라이언트가 연결을 붙잡고 있지 않도록 HandshakeTimeout을 적용합니다.
+func (p *Proxy) serverTLS(conn net.Conn) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.handshakeTimeout())
+	defer cancel()
+
+	tlsConn := tls.Server(conn, p.TLSConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// clientTLS는 업스트림 연결에서 TLS 핸드셰이크를 수행하고 암호화된 연결을 반환합니다.
+// ServerName이 비어 있으면 업스트림 주소의 호스트로 인증서를 검증합니다.
+func (p *Proxy) clientTLS(conn net.Conn, address string) (net.Conn, error) {
+	config := p.UpstreamTLS
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName, _, _ = net.SplitHostPort(address)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.handshakeTimeout())
+	defer cancel()
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
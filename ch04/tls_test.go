@@ -0,0 +1,281 @@
+package ch04
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert는 127.0.0.1과 localhost에 대한 자체 서명 인증서를 생성해 dir에 저장하고,
+// 파일 경로와 인증서를 신뢰하는 인증서 풀을 반환합니다.
+func writeTestCert(t *testing.T, dir string, serial int64) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{Organization: []string{"ch04 test"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true, // 자기 자신을 루트로 신뢰할 수 있도록 CA로 생성
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool = x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+
+	return certFile, keyFile, pool
+}
+
+// peerSerial은 TLS로 addr에 연결해 서버 인증서의 일련번호를 반환합니다.
+func peerSerial(t *testing.T, addr string, config *tls.Config) int64 {
+	t.Helper()
+
+	conn, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+// TestProxyTLSTermination 함수는 프록시가 클라이언트의 TLS를 종료하고 평문 업스트림으로 전달하는지 테스트합니다.
+func TestProxyTLSTermination(t *testing.T) {
+	certFile, keyFile, pool := writeTestCert(t, t.TempDir(), 1)
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newPongServer(t)
+	addr := serveProxy(t, &Proxy{
+		Upstream:  server.Addr().String(),
+		TLSConfig: &tls.Config{GetCertificate: reloader.GetCertificate},
+	})
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	pingPong(t, conn)
+}
+
+// TestProxyTLSOrigination 함수는 평문 클라이언트 연결을 업스트림으로 보낼 때 TLS로 다시 암호화하는지 테스트합니다.
+func TestProxyTLSOrigination(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _ := writeTestCert(t, dir, 1)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 업스트림은 TLS로만 통신하는 서버
+	listener, err := tls.Listen("tcp", "127.0.0.1:", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	servePong(listener)
+
+	// 프록시는 CA 번들 파일로 업스트림의 인증서를 검증
+	pool, err := LoadCABundle(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveProxy(t, &Proxy{
+		Upstream:    listener.Addr().String(),
+		UpstreamTLS: &tls.Config{RootCAs: pool},
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	pingPong(t, conn)
+
+	// 신뢰하지 않는 업스트림이면 연결 실패로 기록되어야 함
+	onClose, reasons := closeRecorder()
+	addr = serveProxy(t, &Proxy{
+		Upstream:    listener.Addr().String(),
+		UpstreamTLS: &tls.Config{RootCAs: x509.NewCertPool()},
+		OnClose:     onClose,
+	})
+	untrusted, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer untrusted.Close()
+
+	expectReason(t, reasons, CloseDialFailure)
+}
+
+// TestCertReloader 함수는 인증서 파일이 바뀌면 새 인증서를 사용하고,
+// 잘못된 파일이면 이전 인증서를 유지하는지 테스트합니다.
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, pool1 := writeTestCert(t, dir, 1)
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := make(chan error, 1)
+	reloader.OnReload = func(err error) {
+		select {
+		case reloaded <- err:
+		default:
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloader.Watch(ctx, 10*time.Millisecond)
+
+	server := newPongServer(t)
+	addr := serveProxy(t, &Proxy{
+		Upstream:  server.Addr().String(),
+		TLSConfig: &tls.Config{GetCertificate: reloader.GetCertificate},
+	})
+
+	if serial := peerSerial(t, addr, &tls.Config{RootCAs: pool1}); serial != 1 {
+		t.Fatalf("expected serial 1; actual %d", serial)
+	}
+
+	// 파일을 교체하고 수정 시각을 바꾸면 자동으로 다시 읽어야 함
+	_, _, pool2 := writeTestCert(t, dir, 2)
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(certFile, future, future); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("certificate was not reloaded")
+	}
+
+	if serial := peerSerial(t, addr, &tls.Config{RootCAs: pool2}); serial != 2 {
+		t.Errorf("expected serial 2; actual %d", serial)
+	}
+
+	// 인증서 파일의 수정 시각이 그대로여도 키 파일이 바뀌면 다시 읽어야 함
+	_, _, pool3 := writeTestCert(t, dir, 3)
+	later := future.Add(time.Minute)
+	if err := os.Chtimes(certFile, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(keyFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("certificate was not reloaded after key change")
+	}
+
+	if serial := peerSerial(t, addr, &tls.Config{RootCAs: pool3}); serial != 3 {
+		t.Errorf("expected serial 3; actual %d", serial)
+	}
+
+	// 잘못된 인증서 파일은 거부하고 이전 인증서를 유지
+	if err := os.WriteFile(certFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloader.Reload(); err == nil {
+		t.Error("expected reload of invalid certificate to fail")
+	}
+	if serial := peerSerial(t, addr, &tls.Config{RootCAs: pool3}); serial != 3 {
+		t.Errorf("expected serial 3 after failed reload; actual %d", serial)
+	}
+}
+
+// TestProxyHandshakeTimeout 함수는 TLS 핸드셰이크나 CONNECT 요청을 보내지 않는 클라이언트를
+// HandshakeTimeout이 지나면 끊는지 테스트합니다.
+func TestProxyHandshakeTimeout(t *testing.T) {
+	certFile, keyFile, _ := writeTestCert(t, t.TempDir(), 1)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newPongServer(t)
+	proxies := map[string]*Proxy{
+		"tls": {
+			Upstream:         server.Addr().String(),
+			TLSConfig:        &tls.Config{Certificates: []tls.Certificate{cert}},
+			HandshakeTimeout: 50 * time.Millisecond,
+		},
+		"connect": {
+			Connect:          true,
+			HandshakeTimeout: 50 * time.Millisecond,
+		},
+	}
+
+	for name, p := range proxies {
+		conn, err := net.Dial("tcp", serveProxy(t, p))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 아무것도 보내지 않으면 프록시가 연결을 닫아야 함 (CONNECT는 408 응답 후)
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		response, err := io.ReadAll(conn)
+		if isTimeout(err) {
+			t.Errorf("%s: expected proxy to close the connection; actual %v", name, err)
+		}
+		if name == "connect" && !bytes.HasPrefix(response, []byte("HTTP/1.1 408")) {
+			t.Errorf("%s: expected 408 response; actual %q", name, response)
+		}
+		_ = conn.Close()
+	}
+}
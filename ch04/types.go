@@ -17,7 +17,10 @@ const (
 )
 
 // 에러 정의
-var ErrMaxPayloadSize = errors.New("maximum payload size exceeded") // 최대 페이로드 크기 초과 에러
+var (
+	ErrMaxPayloadSize = errors.New("maximum payload size exceeded") // 최대 페이로드 크기 초과 에러
+	ErrUnknownType    = errors.New("unknown type")                  // 알 수 없는 타입 에러
+)
 
 // Payload 인터페이스 정의: Stringer, ReaderFrom, WriterTo 인터페이스와 Bytes 메서드 포함
 type Payload interface {
@@ -77,7 +80,7 @@ func (m *Binary) ReadFrom(r io.Reader) (int64, error) {
 	}
 
 	*m = make([]byte, size)
-	o, err := r.Read(*m) // 실제 페이로드 데이터 읽기
+	o, err := io.ReadFull(r, *m) // 실제 페이로드 데이터 읽기 (여러 번에 나누어 도착해도 모두 읽음)
 	return n + int64(o), err
 }
 
@@ -131,7 +134,7 @@ func (m *String) ReadFrom(r io.Reader) (int64, error) {
 	}
 
 	buf := make([]byte, size)
-	o, err := r.Read(buf) // 실제 페이로드 데이터 읽기
+	o, err := io.ReadFull(r, buf) // 실제 페이로드 데이터 읽기 (여러 번에 나누어 도착해도 모두 읽음)
 	if err != nil {
 		return n, err
 	}
@@ -156,7 +159,7 @@ func decode(r io.Reader) (Payload, error) {
 	case StringType:
 		payload = new(String) // String 타입으로 설정
 	default:
-		return nil, errors.New("unknown type") // 알 수 없는 타입 에러
+		return nil, ErrUnknownType // 알 수 없는 타입 에러
 	}
 
 	_, err = payload.ReadFrom(
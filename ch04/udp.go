@@ -0,0 +1,230 @@
+package ch04
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultUDPSessionTimeout = 60 * time.Second // 기본 UDP 세션 유휴 시간
+	maxDatagramSize          = 64 * 1024        // UDP 데이터그램의 최대 크기
+)
+
+// ErrTooManySessions는 MaxSessions에 도달해 새 클라이언트의 데이터그램을 버렸을 때 OnError로 전달됩니다.
+var ErrTooManySessions = errors.New("too many UDP sessions")
+
+// errSessionClosed는 이미 만료되어 닫힌 세션으로 데이터그램을 보내려 할 때 반환됩니다.
+var errSessionClosed = errors.New("UDP session closed")
+
+// UDPProxy는 UDP 데이터그램을 Upstream으로 전달하는 프록시입니다.
+// 클라이언트의 출발지 주소마다 세션을 만들고, 세션마다 업스트림용 소켓을 하나씩 열어
+// 업스트림의 응답을 올바른 클라이언트에게 돌려보냅니다.
+type UDPProxy struct {
+	Upstream    string        // 데이터그램을 전달할 주소 (이름은 Serve를 시작할 때 한 번만 해석)
+	IdleTimeout time.Duration // 세션이 만료되기까지의 유휴 시간 (0이면 defaultUDPSessionTimeout)
+	MaxSessions int           // 동시에 유지할 최대 세션 수 (0이면 제한 없음)
+
+	// OnError가 설정되면 데이터그램을 전달하지 못하고 버렸을 때 클라이언트 주소와 함께 호출됨
+	OnError func(client net.Addr, err error)
+
+	mu       sync.Mutex
+	sessions map[string]*udpSession
+}
+
+// udpSession은 클라이언트 하나와 그 클라이언트를 위한 업스트림 소켓입니다.
+type udpSession struct {
+	client   net.Addr
+	upstream net.Conn
+
+	mu     sync.Mutex
+	active time.Time // 클라이언트가 마지막으로 데이터그램을 보낸 시각
+	closed bool      // 만료되어 더 이상 업스트림으로 보내지 않는지 여부
+}
+
+// write는 세션이 아직 열려 있으면 만료 시간을 연장하고 data를 업스트림으로 보냅니다.
+// 만료와 동시에 쓰지 않도록 세션의 잠금을 잡은 채로 쓰며, 이미 닫혔으면 errSessionClosed를 반환합니다.
+func (s *udpSession) write(data []byte, timeout time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errSessionClosed
+	}
+
+	// 클라이언트가 보낸 데이터도 활동으로 보고 만료 시간을 연장
+	s.active = time.Now()
+	_ = s.upstream.SetReadDeadline(s.active.Add(timeout))
+	_, err := s.upstream.Write(data)
+	return err
+}
+
+// Serve는 conn으로 들어온 데이터그램을 세션별 업스트림 소켓으로 전달합니다.
+// 새 세션을 만들 때마다 이름을 해석하면 그동안 모든 클라이언트의 데이터그램이 기다려야 하므로,
+// Upstream은 시작할 때 한 번만 해석하며 해석에 실패하면 그 에러를 반환합니다.
+// conn이 닫히면 모든 세션을 정리하고 ReadFrom 에러를 반환합니다.
+func (p *UDPProxy) Serve(conn net.PacketConn) error {
+	upstream, err := net.ResolveUDPAddr("udp", p.Upstream)
+	if err != nil {
+		return err
+	}
+	defer p.closeAll()
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, client, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		if err := p.forward(conn, upstream, client, buf[:n]); err != nil && p.OnError != nil {
+			p.OnError(client, err)
+		}
+	}
+}
+
+// forward는 client의 세션으로 data를 업스트림에 보냅니다.
+// 세션이 보내기 직전에 만료되었으면 새 세션을 만들어 다시 보내고,
+// 업스트림 소켓에 쓰지 못하면 세션을 정리해 다음 데이터그램이 새 소켓을 사용하게 합니다.
+func (p *UDPProxy) forward(conn net.PacketConn, upstream *net.UDPAddr, client net.Addr, data []byte) error {
+	for {
+		s, err := p.session(conn, upstream, client)
+		if err != nil {
+			return err // 업스트림 소켓을 열지 못하면 이 데이터그램은 버림
+		}
+
+		switch err := s.write(data, p.idleTimeout()); err {
+		case nil:
+			return nil
+		case errSessionClosed:
+			p.remove(s) // 만료와 겹쳤으면 새 세션으로 다시 보냄
+			continue
+		default:
+			p.expire(s)
+			return err
+		}
+	}
+}
+
+// Sessions는 현재 활성 세션 수를 반환합니다.
+func (p *UDPProxy) Sessions() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sessions)
+}
+
+// idleTimeout은 실제로 적용할 세션 유휴 시간을 반환합니다.
+func (p *UDPProxy) idleTimeout() time.Duration {
+	if p.IdleTimeout > 0 {
+		return p.IdleTimeout
+	}
+	return defaultUDPSessionTimeout
+}
+
+// full은 새 세션을 만들 수 없는지 확인합니다. p.mu를 잡은 상태에서 호출해야 합니다.
+func (p *UDPProxy) full() bool {
+	return p.MaxSessions > 0 && len(p.sessions) >= p.MaxSessions
+}
+
+// session은 client의 세션을 찾고, 없으면 이미 해석한 upstream 주소로 업스트림 소켓을 열어 새 세션을 만듭니다.
+func (p *UDPProxy) session(conn net.PacketConn, upstream *net.UDPAddr, client net.Addr) (*udpSession, error) {
+	key := client.String()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if s, ok := p.sessions[key]; ok {
+		return s, nil
+	}
+	if p.full() {
+		return nil, ErrTooManySessions
+	}
+
+	uConn, err := net.DialUDP("udp", nil, upstream) // 이름 해석 없이 소켓만 만듦
+	if err != nil {
+		return nil, err
+	}
+
+	if p.sessions == nil {
+		p.sessions = make(map[string]*udpSession)
+	}
+	s := &udpSession{client: client, upstream: uConn, active: time.Now()}
+	p.sessions[key] = s
+
+	go p.reply(conn, s)
+
+	return s, nil
+}
+
+// reply는 업스트림의 응답을 클라이언트에게 돌려보냅니다.
+// 유휴 시간 동안 어느 방향으로도 데이터가 없으면 읽기 데드라인이 지나 세션을 정리합니다.
+func (p *UDPProxy) reply(conn net.PacketConn, s *udpSession) {
+	defer p.expire(s)
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		_ = s.upstream.SetReadDeadline(time.Now().Add(p.idleTimeout()))
+		n, err := s.upstream.Read(buf)
+		if err != nil {
+			if isTimeout(err) && !s.idle(p.idleTimeout()) {
+				continue // 타임아웃 직전에 클라이언트가 데이터그램을 보냈으면 응답을 계속 기다림
+			}
+			return // 유휴 시간 초과이거나 세션이 닫힘
+		}
+
+		if _, err := conn.WriteTo(buf[:n], s.client); err != nil {
+			return
+		}
+	}
+}
+
+// idle은 timeout 동안 클라이언트가 보낸 데이터그램이 없었는지 확인하고, 그렇다면 세션을 닫힘으로 표시합니다.
+// 닫힘 표시와 write가 같은 잠금을 사용하므로 응답을 읽지 않는 세션으로 데이터그램을 보내지 않습니다.
+func (s *udpSession) idle(timeout time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed && time.Since(s.active) < timeout {
+		return false
+	}
+	s.closed = true
+	return true
+}
+
+// expire는 세션을 닫고 목록에서 지웁니다.
+// 세션을 닫힘으로 표시하므로 이후 이 세션으로 보내려는 데이터그램은 새 세션으로 전달됩니다.
+func (p *UDPProxy) expire(s *udpSession) {
+	s.close()
+	p.remove(s)
+}
+
+// remove는 s가 아직 목록에 있으면 지웁니다.
+func (p *UDPProxy) remove(s *udpSession) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sessions[s.client.String()] == s {
+		delete(p.sessions, s.client.String())
+	}
+}
+
+// close는 세션을 닫힘으로 표시하고 업스트림 소켓을 닫습니다.
+func (s *udpSession) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	_ = s.upstream.Close()
+}
+
+// closeAll은 모든 세션의 업스트림 소켓을 닫습니다.
+func (p *UDPProxy) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, s := range p.sessions {
+		s.close()
+		delete(p.sessions, key)
+	}
+}
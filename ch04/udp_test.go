@@ -0,0 +1,168 @@
+package ch04
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// newUDPEchoServer는 받은 데이터그램 앞에 "echo:"를 붙여 돌려보내는 UDP 서버를 시작합니다.
+func newUDPEchoServer(t *testing.T) net.PacketConn {
+	t.Helper()
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := server.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = server.WriteTo(append([]byte("echo:"), buf[:n]...), addr)
+		}
+	}()
+
+	return server
+}
+
+// udpExchange는 conn으로 msg를 보내고 받은 응답을 반환합니다.
+func udpExchange(t *testing.T, conn net.Conn, msg string) string {
+	t.Helper()
+
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+// TestUDPProxy 함수는 여러 클라이언트의 데이터그램이 세션별로 전달되고
+// 응답이 올바른 클라이언트에게 돌아가며, 유휴 세션이 만료되는지 테스트합니다.
+func TestUDPProxy(t *testing.T) {
+	server := newUDPEchoServer(t)
+
+	listener, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	p := &UDPProxy{Upstream: server.LocalAddr().String(), IdleTimeout: 100 * time.Millisecond}
+	go func() { _ = p.Serve(listener) }()
+
+	var clients []net.Conn
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("udp", listener.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		clients = append(clients, conn)
+	}
+
+	// 각 클라이언트는 자신이 보낸 데이터그램에 대한 응답만 받아야 함
+	for round := 0; round < 2; round++ {
+		for i, conn := range clients {
+			msg := string(rune('a' + i))
+			if reply := udpExchange(t, conn, msg); reply != "echo:"+msg {
+				t.Errorf("client %d: expected %q; actual %q", i, "echo:"+msg, reply)
+			}
+		}
+	}
+	if n := p.Sessions(); n != 2 {
+		t.Errorf("expected 2 sessions; actual %d", n)
+	}
+
+	// 유휴 시간이 지나면 세션이 만료되어야 함
+	time.Sleep(300 * time.Millisecond)
+	if n := p.Sessions(); n != 0 {
+		t.Errorf("expected idle sessions to expire; actual %d", n)
+	}
+
+	// 만료된 뒤에도 같은 클라이언트가 다시 보내면 새 세션이 만들어짐
+	if reply := udpExchange(t, clients[0], "again"); reply != "echo:again" {
+		t.Errorf("expected %q; actual %q", "echo:again", reply)
+	}
+}
+
+// TestUDPProxyMaxSessions 함수는 세션 수가 MaxSessions에 도달하면 새 클라이언트의 데이터그램을 버리고
+// OnError로 알리며, 세션이 만료되면 다시 받아들이는지 테스트합니다.
+func TestUDPProxyMaxSessions(t *testing.T) {
+	server := newUDPEchoServer(t)
+
+	listener, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	errs := make(chan error, 10)
+	p := &UDPProxy{
+		Upstream:    server.LocalAddr().String(),
+		IdleTimeout: 100 * time.Millisecond,
+		MaxSessions: 1,
+		OnError:     func(_ net.Addr, err error) { errs <- err },
+	}
+	go func() { _ = p.Serve(listener) }()
+
+	var clients []net.Conn
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("udp", listener.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		clients = append(clients, conn)
+	}
+
+	if reply := udpExchange(t, clients[0], "a"); reply != "echo:a" {
+		t.Errorf("expected %q; actual %q", "echo:a", reply)
+	}
+
+	// 두 번째 클라이언트의 데이터그램은 버려져야 함
+	if _, err := clients[1].Write([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if err != ErrTooManySessions {
+			t.Errorf("expected %v; actual %v", ErrTooManySessions, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected dropped datagram to be reported")
+	}
+	if n := p.Sessions(); n != 1 {
+		t.Errorf("expected 1 session; actual %d", n)
+	}
+
+	// 첫 번째 세션이 만료되면 두 번째 클라이언트도 세션을 만들 수 있음
+	time.Sleep(300 * time.Millisecond)
+	if reply := udpExchange(t, clients[1], "b"); reply != "echo:b" {
+		t.Errorf("expected %q; actual %q", "echo:b", reply)
+	}
+}
+
+// TestUDPProxyResolveError 함수는 Upstream 주소를 해석할 수 없으면 Serve가 데이터그램을 받기 전에 에러를 반환하는지 테스트합니다.
+func TestUDPProxyResolveError(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	p := &UDPProxy{Upstream: "127.0.0.1:99999"}
+	if err := p.Serve(listener); err == nil {
+		t.Error("expected resolve error")
+	}
+}
@@ -0,0 +1,51 @@
+package ch04
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+// Unix 소켓 관련 에러 정의
+var (
+	ErrPeerNotAllowed      = errors.New("peer credentials not allowed")        // AllowPeer가 거부한 연결
+	ErrPeerCredUnsupported = errors.New("peer credentials not supported")      // SO_PEERCRED를 지원하지 않는 플랫폼
+	ErrNotUnixConn         = errors.New("not a unix domain socket connection") // Unix 소켓이 아닌 연결
+)
+
+// PeerCred는 Unix 소켓 상대 프로세스의 자격 증명입니다.
+type PeerCred struct {
+	PID int32  // 프로세스 ID
+	UID uint32 // 사용자 ID
+	GID uint32 // 그룹 ID
+}
+
+// splitNetwork는 "unix:///path/to.sock"이나 "tcp://host:port"처럼 "네트워크://" 접두사가 붙은 주소를
+// 네트워크와 주소로 나눕니다. 접두사가 없으면 TCP 주소로 봅니다.
+// "unix:80"처럼 호스트 이름이 네트워크 이름과 같아도 "://"가 없으면 TCP 주소입니다.
+// Linux에서는 "unix://@name"처럼 '@'로 시작하는 이름이 추상(abstract) 소켓을 뜻합니다.
+func splitNetwork(address string) (network, addr string) {
+	for _, prefix := range []string{"unix", "tcp", "tcp4", "tcp6"} {
+		if rest, ok := strings.CutPrefix(address, prefix+"://"); ok {
+			return prefix, rest
+		}
+	}
+	return "tcp", address
+}
+
+// checkPeer는 AllowPeer가 설정되어 있을 때 연결의 자격 증명을 검사합니다.
+// 자격 증명을 읽을 수 없는 연결(TCP 연결이나 SO_PEERCRED를 지원하지 않는 플랫폼)은 거부합니다.
+func (p *Proxy) checkPeer(conn net.Conn) error {
+	if p.AllowPeer == nil {
+		return nil
+	}
+
+	cred, err := PeerCredentials(baseConn(conn))
+	if err != nil {
+		return err
+	}
+	if !p.AllowPeer(cred) {
+		return ErrPeerNotAllowed
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package ch04
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"testing"
+)
+
+// TestProxyAbstractSocket 함수는 Linux 추상 소켓으로 수신하고 전달할 수 있는지 테스트합니다.
+func TestProxyAbstractSocket(t *testing.T) {
+	name := fmt.Sprintf("@ch04-test-%d", os.Getpid())
+
+	server, err := net.Listen("unix", name+"-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	servePong(server)
+
+	listener, err := net.Listen("unix", name+"-proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() { _ = (&Proxy{Upstream: "unix://" + name + "-server"}).Serve(listener) }()
+
+	conn, err := net.Dial("unix", name+"-proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	pingPong(t, conn)
+}
+
+// TestProxyAllowPeer 함수는 SO_PEERCRED로 얻은 자격 증명에 따라 연결을 허용하거나 거부하는지 테스트합니다.
+func TestProxyAllowPeer(t *testing.T) {
+	server := newPongServer(t)
+	uid := uint32(os.Getuid())
+
+	for _, allowed := range []bool{true, false} {
+		name := fmt.Sprintf("@ch04-peer-%d-%t", os.Getpid(), allowed)
+		listener, err := net.Listen("unix", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+
+		creds := make(chan PeerCred, 1)
+		p := &Proxy{
+			Upstream: server.Addr().String(),
+			AllowPeer: func(cred PeerCred) bool {
+				creds <- cred
+				return allowed && cred.UID == uid
+			},
+		}
+		go func() { _ = p.Serve(listener) }()
+
+		conn, err := net.Dial("unix", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		if allowed {
+			pingPong(t, conn)
+		} else if _, err := conn.Read(make([]byte, 1)); err == nil {
+			t.Error("expected connection to be rejected")
+		}
+
+		if cred := <-creds; cred.UID != uid || cred.PID != int32(os.Getpid()) {
+			t.Errorf("unexpected peer credentials: %+v", cred)
+		}
+	}
+}
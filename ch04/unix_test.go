@@ -0,0 +1,86 @@
+package ch04
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// TestProxyUnixToTCP 함수는 Unix 소켓으로 들어온 연결을 TCP 업스트림으로 전달하는지 테스트합니다.
+func TestProxyUnixToTCP(t *testing.T) {
+	server := newPongServer(t)
+
+	socket := filepath.Join(t.TempDir(), "proxy.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() { _ = (&Proxy{Upstream: server.Addr().String()}).Serve(listener) }()
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	pingPong(t, conn)
+}
+
+// TestProxyTCPToUnix 함수는 TCP로 들어온 연결을 "unix://" 업스트림으로 전달하는지 테스트합니다.
+func TestProxyTCPToUnix(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "server.sock")
+	server, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	servePong(server)
+
+	addr := serveProxy(t, &Proxy{Upstream: "unix://" + socket})
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	pingPong(t, conn)
+}
+
+// TestProxyAllowPeerTCP 함수는 AllowPeer가 설정되어 있으면 자격 증명을 읽을 수 없는 TCP 연결을 거부하는지 테스트합니다.
+func TestProxyAllowPeerTCP(t *testing.T) {
+	server := newPongServer(t)
+	onClose, reasons := closeRecorder()
+	addr := serveProxy(t, &Proxy{
+		Upstream:  server.Addr().String(),
+		AllowPeer: func(PeerCred) bool { return true },
+		OnClose:   onClose,
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	expectReason(t, reasons, CloseRejected)
+}
+
+// TestSplitNetwork 함수는 접두사에 따라 네트워크와 주소를 올바르게 나누는지 테스트합니다.
+func TestSplitNetwork(t *testing.T) {
+	tests := []struct{ input, network, address string }{
+		{"127.0.0.1:80", "tcp", "127.0.0.1:80"},
+		{"tcp6://[::1]:80", "tcp6", "[::1]:80"},
+		{"unix:///tmp/x.sock", "unix", "/tmp/x.sock"},
+		{"unix://@abstract", "unix", "@abstract"},
+		{"unix:80", "tcp", "unix:80"}, // 호스트 이름이 "unix"인 TCP 주소
+		{"tcp:443", "tcp", "tcp:443"},
+	}
+
+	for _, tc := range tests {
+		network, address := splitNetwork(tc.input)
+		if network != tc.network || address != tc.address {
+			t.Errorf("%q: expected %s %q; actual %s %q", tc.input, tc.network, tc.address, network, address)
+		}
+	}
+}